@@ -0,0 +1,44 @@
+package synth
+
+import (
+	"sort"
+)
+
+// AutomationPoint is a value that an Automation should have at the given time, in seconds
+type AutomationPoint struct {
+	Time  float64
+	Value float64
+}
+
+// Automation is a parameter that changes over time, by interpolating linearly between points.
+// Before the first point and after the last point, the value of the nearest point is used.
+type Automation struct {
+	Points []AutomationPoint
+}
+
+// NewAutomation creates a new Automation from the given points, which do not need to be sorted
+func NewAutomation(points ...AutomationPoint) *Automation {
+	sorted := append([]AutomationPoint(nil), points...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time < sorted[j].Time
+	})
+	return &Automation{Points: sorted}
+}
+
+// ValueAt returns the value of the automation at the given time, in seconds.
+// A nil or empty automation always returns 0.
+func (a *Automation) ValueAt(t float64) float64 {
+	if a == nil || len(a.Points) == 0 {
+		return 0
+	}
+	if t <= a.Points[0].Time {
+		return a.Points[0].Value
+	}
+	for i := 1; i < len(a.Points); i++ {
+		if next := a.Points[i]; t < next.Time {
+			prev := a.Points[i-1]
+			return prev.Value + (next.Value-prev.Value)*(t-prev.Time)/(next.Time-prev.Time)
+		}
+	}
+	return a.Points[len(a.Points)-1].Value
+}
@@ -43,6 +43,7 @@ func main() {
 	saturatorAmount := flag.Float64("saturator", 0.3, "Amount of saturation to apply")
 	filterBands := flag.String("filterbands", "200,1000,3000", "Comma-separated multi-band filter cutoff frequencies")
 	outputFile := flag.String("o", "kick.wav", "Output file path")
+	csvFile := flag.String("csv", "", "Also write the waveform as time,amplitude rows to this CSV file")
 	playKick := flag.Bool("p", false, "Play the generated kick") // Added -p flag
 	showVersion := flag.Bool("version", false, "Show the current version")
 	showHelp := flag.Bool("help", false, "Display this help")
@@ -133,9 +134,6 @@ func main() {
 		return
 	}
 
-	// Apply a fade-out at the end to prevent crackling noise
-	samples = synth.ApplyQuadraticFadeOut(samples, cfg.Release, sampleRate)
-
 	// Open the output file for writing
 	outFile, err := os.Create(*outputFile)
 	if err != nil {
@@ -152,6 +150,21 @@ func main() {
 
 	fmt.Println("Kick drum sound generated and written to", *outputFile)
 
+	// Write the waveform as CSV, if -csv is provided
+	if *csvFile != "" {
+		f, err := os.Create(*csvFile)
+		if err != nil {
+			fmt.Println("Failed to create CSV file:", err)
+			return
+		}
+		defer f.Close()
+		if err := synth.ExportCSV(f, samples, sampleRate); err != nil {
+			fmt.Println("Failed to write CSV file:", err)
+			return
+		}
+		fmt.Println("Waveform written to", *csvFile)
+	}
+
 	// Play the kick if -p flag is provided
 	if *playKick {
 		fmt.Println("Playing the generated kick drum sound...")
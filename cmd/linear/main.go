@@ -19,6 +19,7 @@ func main() {
 	outputFile := flag.String("o", "combined.wav", "Specify the output file")
 	lowPassCutoff := flag.Float64("lowpass", 15000, "Low-pass filter cutoff frequency in Hz (0 to disable)")
 	fadeDuration := flag.Float64("fadeout", 0.01, "Fade-out duration in seconds")
+	qualityName := flag.String("quality", "cubic", "Resampling quality for inputs with a different sample rate (linear, cubic or sinc)")
 	showVersion := flag.Bool("version", false, "Show the version and exit")
 	showHelp := flag.Bool("help", false, "Show help")
 
@@ -37,6 +38,11 @@ func main() {
 		return
 	}
 
+	quality, err := synth.ParseResampleQuality(*qualityName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	// Expect at least two input files
 	if flag.NArg() < 2 {
 		fmt.Println("Usage: mix [options] <input1.wav> <input2.wav> [additional input files...]")
@@ -63,9 +69,10 @@ func main() {
 			log.Fatalf("Failed to load %s: %v", inputFile, err)
 		}
 
-		// Ensure the sample rate matches
+		// Convert the sample rate to the one of the first file, if needed
 		if sr != sampleRate {
-			log.Fatalf("Sample rate mismatch between %s and %s", firstFile, inputFile)
+			fmt.Printf("Resampling %s from %d Hz to %d Hz\n", inputFile, sr, sampleRate)
+			wave = synth.ResampleWithQuality(wave, sr, sampleRate, quality)
 		}
 
 		// Find the peak amplitude in the current file and track the loudest peak
@@ -17,6 +17,8 @@ const bitDepth = 16
 func main() {
 	// Define flags
 	outputFile := flag.String("o", "combined.wav", "Specify the output file")
+	ceiling := flag.Float64("ceiling", 0, "Specify the peak ceiling of the mix, in dBFS")
+	qualityName := flag.String("quality", "cubic", "Resampling quality for inputs with a different sample rate (linear, cubic or sinc)")
 	showVersion := flag.Bool("version", false, "Show the version and exit")
 	showHelp := flag.Bool("help", false, "Show help")
 
@@ -35,6 +37,11 @@ func main() {
 		return
 	}
 
+	quality, err := synth.ParseResampleQuality(*qualityName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	// Expect at least two input files
 	if flag.NArg() < 2 {
 		fmt.Println("Usage: rms [options] <input1.wav> <input2.wav> [additional input files...]")
@@ -61,9 +68,10 @@ func main() {
 			log.Fatalf("Failed to load %s: %v", inputFile, err)
 		}
 
-		// Ensure the sample rate matches
+		// Convert the sample rate to the one of the first file, if needed
 		if sr != sampleRate {
-			log.Fatalf("Sample rate mismatch between %s and %s", firstFile, inputFile)
+			fmt.Printf("Resampling %s from %d Hz to %d Hz\n", inputFile, sr, sampleRate)
+			wave = synth.ResampleWithQuality(wave, sr, sampleRate, quality)
 		}
 
 		// Find the peak amplitude in the current file and track the loudest peak
@@ -86,6 +94,12 @@ func main() {
 	fmt.Printf("Normalizing loudness to the loudest peak: %f\n", loudestPeak)
 	combined = synth.NormalizeSamples(combined, loudestPeak)
 
+	// Bring the peak of the mix down to the ceiling, if it is above it
+	if synth.FindPeakAmplitude(combined) > synth.DBToLinear(*ceiling) {
+		fmt.Printf("Normalizing the peak to the ceiling: %.2f dBFS\n", *ceiling)
+		combined = synth.NormalizeToDBFS(combined, *ceiling)
+	}
+
 	// Apply a quick fade-out to the end of the combined samples
 	fadeDuration := 0.01 // Fade-out duration in seconds (10 milliseconds)
 	combined = synth.ApplyQuadraticFadeOut(combined, fadeDuration, sampleRate)
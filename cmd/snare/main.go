@@ -106,6 +106,7 @@ func main() {
 	cfg.Decay = *decay
 	cfg.Sustain = *sustain
 	cfg.Release = *release
+	cfg.FadeDuration = *release // Match fade duration to release time
 	cfg.FilterCutoff = *filterCutoff
 	cfg.Drive = *drive
 	cfg.SmoothFrequencyTransitions = true
@@ -132,13 +133,10 @@ func main() {
 			samples[i] += noiseSamples[i]
 		}
 
-		// Apply limiter to prevent clipping
-		samples = synth.Limiter(samples)
+		// Apply limiter to prevent clipping, and fade out the added noise, which was mixed in after the clean tail
+		samples = synth.CleanTail(synth.Limiter(samples), cfg.FadeDuration, sampleRate)
 	}
 
-	// Apply a fade-out at the end to prevent crackling noise
-	samples = synth.ApplyQuadraticFadeOut(samples, cfg.Release, sampleRate)
-
 	// Open the output file for writing
 	outFile, err := os.Create(*outputFile)
 	if err != nil {
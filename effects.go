@@ -1,6 +1,12 @@
 package synth
 
 import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"sort"
+
 	"github.com/xyproto/audioeffects"
 )
 
@@ -9,15 +15,97 @@ func ApplyEnvelope(samples []float64, attack, decay, sustain, release float64, s
 	return audioeffects.Envelope(samples, attack, decay, sustain, release, sampleRate)
 }
 
+// ApplyExponentialDecay applies an envelope with an instant attack and an exponential decay,
+// where the level has fallen to 1/e after decaySec seconds. This is a fast and natural sounding envelope for drums.
+func ApplyExponentialDecay(samples []float64, decaySec float64, sampleRate int) []float64 {
+	decayed := make([]float64, len(samples))
+	if decaySec <= 0 {
+		copy(decayed, samples)
+		return decayed
+	}
+	factor := math.Exp(-1.0 / (decaySec * float64(sampleRate)))
+	level := 1.0
+	for i, sample := range samples {
+		decayed[i] = sample * level
+		level *= factor
+	}
+	return decayed
+}
+
+// applyEnvelope applies the amplitude envelope of the generators, which is the ADSR envelope,
+// or an exponential decay with Decay as the time constant if UseExponentialDecay is enabled
+func (cfg *Settings) applyEnvelope(samples []float64) []float64 {
+	if cfg.UseExponentialDecay {
+		return ApplyExponentialDecay(samples, cfg.Decay, cfg.SampleRate)
+	}
+	return ApplyEnvelope(samples, cfg.Attack, cfg.Decay, cfg.Sustain, cfg.Release, cfg.SampleRate)
+}
+
 // ApplyEnvelopeAtTime generates the ADSR envelope value at a specific normalized time.
 // This function retains the custom implementation as audioeffects does not expose envelope evaluation at a specific time.
+// If UseExponentialDecay is enabled, the exponential decay envelope is used instead.
 func (cfg *Settings) ApplyEnvelopeAtTime(t float64) float64 {
+	if cfg.UseExponentialDecay {
+		if cfg.Decay <= 0 {
+			return 1
+		}
+		return math.Exp(-t / cfg.Decay)
+	}
 	return audioeffects.EnvelopeAtTime(t, cfg.Attack, cfg.Decay, cfg.Sustain, cfg.Release, cfg.Duration)
 }
 
+// EnvelopePoints returns the ADSR envelope sampled at numPoints evenly spaced points over the duration,
+// which is useful for visualizing the envelope
+func (cfg *Settings) EnvelopePoints(numPoints int) []float64 {
+	if numPoints <= 0 {
+		return []float64{}
+	}
+	points := make([]float64, numPoints)
+	if numPoints == 1 {
+		points[0] = cfg.ApplyEnvelopeAtTime(0)
+		return points
+	}
+	for i := range points {
+		t := float64(i) * cfg.Duration / float64(numPoints-1)
+		points[i] = cfg.ApplyEnvelopeAtTime(t)
+	}
+	return points
+}
+
 // ApplyDrive applies a drive (distortion) effect to a single sample using the audioeffects package.
+// Drive is the amount, where 0 leaves the sample unchanged. The character follows the DriveMode,
+// and is soft clipping by default.
 func (cfg *Settings) ApplyDrive(sample float64) float64 {
-	return audioeffects.Drive(sample, cfg.Drive)
+	if cfg.DriveMode == DriveDefault {
+		return audioeffects.Drive(sample, cfg.Drive)
+	}
+	return shapeDrive(sample, 1+cfg.Drive, cfg.DriveMode)
+}
+
+// drive applies the drive stage of the generators that drive all of the samples at once. The character follows
+// the DriveMode, and by default, the samples are hard clipped with Drive as the gain, like for Drive.
+func (cfg *Settings) drive(samples []float64) []float64 {
+	if cfg.DriveMode == DriveDefault {
+		return Drive(samples, cfg.Drive)
+	}
+	driven := make([]float64, len(samples))
+	for i, sample := range samples {
+		driven[i] = shapeDrive(sample, 1+cfg.Drive, cfg.DriveMode)
+	}
+	return driven
+}
+
+// shapeDrive scales the sample by the gain and distorts it with the given drive mode: hard clipping at ±1,
+// a tanh curve, or a rational soft clipping curve that reaches ±1 at a full scale input
+func shapeDrive(sample, gain float64, mode int) float64 {
+	switch mode {
+	case DriveHard:
+		return math.Max(-1, math.Min(1, gain*sample))
+	case DriveTanh:
+		return math.Tanh(gain * sample)
+	default:
+		return gain * sample / (1 + math.Max(gain-1, 0)*math.Abs(sample))
+	}
 }
 
 // ApplyPitchModulation applies pitch modulation (vibrato) to the samples using the audioeffects package.
@@ -31,13 +119,184 @@ func ApplyPanning(samples []float64, pan float64) ([]float64, []float64) {
 	return audioeffects.Panning(samples, pan)
 }
 
-// ApplyFrequencyModulation applies frequency modulation to a waveform using the audioeffects package.
+// ApplyFrequencyModulation applies frequency modulation using the audioeffects package.
+// The samples are used as the modulator, and the returned samples are a sine carrier wave, so the input
+// is replaced and not frequency modulated. Use ApplyVibrato to modulate the pitch of an existing sound.
 // carrierFreq is the base frequency of the carrier wave.
 // modDepth controls the extent of frequency deviation.
 func ApplyFrequencyModulation(samples []float64, carrierFreq, modDepth float64, sampleRate int) []float64 {
 	return audioeffects.FrequencyModulation(samples, carrierFreq, modDepth, float64(sampleRate))
 }
 
+// ApplyVibrato modulates the pitch of the samples up and down by depthSemitones, rateHz times per second.
+// The samples are read through a delay that changes over time, and the pitch follows the rate of change
+// of the delay, so the pitch is first bent down, then up, and back again.
+func ApplyVibrato(samples []float64, rateHz, depthSemitones float64, sampleRate int) []float64 {
+	vibrato := make([]float64, len(samples))
+	if rateHz <= 0 || depthSemitones == 0 {
+		copy(vibrato, samples)
+		return vibrato
+	}
+	// With the delay A * (1 - cos(wt)), the pitch ratio is 1 - A * w * sin(wt)
+	w := 2 * math.Pi * rateHz
+	amplitude := (math.Pow(2, math.Abs(depthSemitones)/12) - 1) / w
+	for i := range samples {
+		t := float64(i) / float64(sampleRate)
+		pos := float64(i) - amplitude*(1-math.Cos(w*t))*float64(sampleRate)
+		index := int(math.Floor(pos))
+		frac := pos - float64(index)
+		if index < 0 || index >= len(samples) {
+			continue
+		}
+		next := 0.0
+		if index+1 < len(samples) {
+			next = samples[index+1]
+		}
+		vibrato[i] = samples[index]*(1-frac) + next*frac
+	}
+	return vibrato
+}
+
+// stretchFrameDuration is the length of the overlapping frames of the time-stretch, in seconds
+const stretchFrameDuration = 0.04
+
+// stretchTolerance is how far, in seconds, a frame of the time-stretch may be moved to line up with the previous frame
+const stretchTolerance = 0.01
+
+// WarpToBars fits a loop that was made at sourceBPM to targetBPM, by stretching it in time to the new length
+// without changing the pitch, so that the bars line up with the new tempo
+func WarpToBars(samples []float64, sourceBPM, targetBPM float64, sampleRate int) []float64 {
+	if sourceBPM <= 0 || targetBPM <= 0 {
+		return append([]float64(nil), samples...)
+	}
+	return timeStretch(samples, sourceBPM/targetBPM, sampleRate)
+}
+
+// timeStretch changes the length of the samples by ratio, while keeping the pitch. This is done with WSOLA
+// (waveform similarity overlap-add): Hann windowed frames are overlap-added at half a frame apart, and each
+// frame is read from around its nominal position in the input, where it best continues the previous frame,
+// so that the frames add up in phase.
+func timeStretch(samples []float64, ratio float64, sampleRate int) []float64 {
+	outputLength := int(float64(len(samples)) * ratio)
+	frameSize := int(stretchFrameDuration * float64(sampleRate))
+	if len(samples) < frameSize || ratio == 1 || frameSize < 4 {
+		// Too short for overlapping frames, so fall back to a plain resample
+		return Resample(samples, sampleRate, int(float64(sampleRate)*ratio))
+	}
+	hop := frameSize / 2
+	tolerance := int(stretchTolerance * float64(sampleRate))
+	window := make([]float64, frameSize)
+	for n := range window {
+		window[n] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(n)/float64(frameSize))
+	}
+	stretched := make([]float64, outputLength+frameSize)
+	weights := make([]float64, len(stretched))
+	lastStart := len(samples) - frameSize
+	previous := 0
+	for k := 0; k*hop < outputLength; k++ {
+		start := 0
+		if k > 0 {
+			// Pick the frame near the nominal position that is most similar to the natural continuation
+			// of the previous frame
+			nominal := int(float64(k*hop) / ratio)
+			natural := min(previous+hop, lastStart)
+			best := math.Inf(-1)
+			for candidate := max(nominal-tolerance, 0); candidate <= min(nominal+tolerance, lastStart); candidate++ {
+				similarity := 0.0
+				for n := 0; n < frameSize; n++ {
+					similarity += samples[candidate+n] * samples[natural+n]
+				}
+				if similarity > best {
+					best = similarity
+					start = candidate
+				}
+			}
+			if math.IsInf(best, -1) {
+				start = lastStart
+			}
+		}
+		for n := 0; n < frameSize; n++ {
+			stretched[k*hop+n] += samples[start+n] * window[n]
+			weights[k*hop+n] += window[n]
+		}
+		previous = start
+	}
+	for i := range stretched {
+		if weights[i] > 1e-3 {
+			stretched[i] /= weights[i]
+		}
+	}
+	return stretched[:outputLength]
+}
+
+// ApplySpectralFreeze captures the spectrum at freezeAtSec and sustains it for holdSec seconds, before the rest
+// of the samples continue, which is useful for drones and pads. The frozen spectrum is resynthesized with a
+// phase vocoder, where each frequency bin keeps advancing by the phase difference that was measured between
+// two frames, hop samples apart. fftSize is rounded up to a power of two, and a hop of 0 gives a quarter of
+// fftSize. The dry signal is crossfaded with the frozen sound at both ends.
+func ApplySpectralFreeze(samples []float64, freezeAtSec, holdSec float64, fftSize, hop, sampleRate int) []float64 {
+	fftSize = nextPowerOfTwo(fftSize)
+	if hop <= 0 || hop > fftSize {
+		hop = max(fftSize/4, 1)
+	}
+	holdLength := int(holdSec * float64(sampleRate))
+	freezeStart := min(max(int(freezeAtSec*float64(sampleRate)), 0), len(samples))
+	if holdLength <= 0 || fftSize < 4 {
+		return append([]float64(nil), samples...)
+	}
+	window := Window(fftSize, WindowHann)
+	first := spectrumAt(samples, freezeStart-fftSize/2, window)
+	second := spectrumAt(samples, freezeStart-fftSize/2+hop, window)
+	advance := make([]float64, fftSize)
+	for k := range advance {
+		advance[k] = cmplx.Phase(second[k]) - cmplx.Phase(first[k])
+	}
+
+	// Overlap-add the resynthesized frames, with the frame centers spread over the hold
+	length := len(samples) + holdLength
+	frozen := make([]float64, length)
+	weights := make([]float64, length)
+	frame := make([]complex128, fftSize)
+	for m := 0; m*hop <= holdLength; m++ {
+		for k := range frame {
+			frame[k] = cmplx.Rect(cmplx.Abs(first[k]), cmplx.Phase(first[k])+float64(m)*advance[k])
+		}
+		ifft(frame)
+		start := freezeStart - fftSize/2 + m*hop
+		for n, w := range window {
+			if i := start + n; i >= 0 && i < length {
+				frozen[i] += real(frame[n]) * w
+				weights[i] += w * w
+			}
+		}
+	}
+	// The steady state gain of the overlapping windows, in the middle of the hold
+	norm := 0.0
+	for _, w := range weights {
+		norm = math.Max(norm, w)
+	}
+
+	output := make([]float64, length)
+	for i := range output {
+		// Before the middle of the hold, the dry signal fades out, and after it, the rest of the dry signal fades in
+		j := i
+		if i >= freezeStart+holdLength/2 {
+			j = i - holdLength
+		}
+		dry := 0.0
+		if j >= 0 && j < len(samples) {
+			dry = samples[j]
+		}
+		mix := 0.0
+		if norm > 0 {
+			mix = math.Min(weights[i]/norm, 1)
+			frozen[i] /= norm
+		}
+		output[i] = frozen[i] + dry*(1-mix)
+	}
+	return output
+}
+
 // ApplyFadeIn applies a fade-in to the start of the samples using the audioeffects package.
 func ApplyFadeIn(samples []float64, fadeDuration float64, sampleRate int) []float64 {
 	return audioeffects.FadeIn(samples, fadeDuration, sampleRate)
@@ -70,8 +329,101 @@ func ApplyChorus(samples []float64, sampleRate int, delaySec, depth, rate, mix f
 // ApplyReverb applies a reverb effect to the samples using the audioeffects package.
 // delayTimes and decays should be of the same length, specifying multiple delay and decay pairs.
 // mix determines the blend between dry and wet signals.
-func ApplyReverb(samples []float64, sampleRate int, delayTimes, decays []float64, mix float64) []float64 {
-	return audioeffects.Reverb(samples, sampleRate, delayTimes, decays, mix)
+// Returns an error if delayTimes and decays are not of the same length.
+func ApplyReverb(samples []float64, sampleRate int, delayTimes, decays []float64, mix float64) ([]float64, error) {
+	if err := validateReverb(sampleRate, delayTimes, decays); err != nil {
+		return nil, err
+	}
+	return audioeffects.Reverb(samples, sampleRate, delayTimes, decays, mix), nil
+}
+
+// validateReverb checks that there is one decay per delay time, since audioeffects.Reverb silently
+// returns the samples unchanged otherwise
+func validateReverb(sampleRate int, delayTimes, decays []float64) error {
+	if sampleRate <= 0 {
+		return fmt.Errorf("invalid sample rate: %d", sampleRate)
+	}
+	if len(delayTimes) != len(decays) {
+		return fmt.Errorf("expected one decay per delay time, got %d delay times and %d decays", len(delayTimes), len(decays))
+	}
+	return nil
+}
+
+// ApplyEarlyReflections mixes discrete early reflections into the samples, each one a copy of the dry
+// signal that is delayed by DelaySec seconds and scaled by Gain, like the first echoes from the walls of
+// a room that arrive before the diffuse tail of the reverb. The length of the samples is kept.
+func ApplyEarlyReflections(samples []float64, sampleRate int, reflections []struct{ DelaySec, Gain float64 }) []float64 {
+	reflected := make([]float64, len(samples))
+	copy(reflected, samples)
+	for _, reflection := range reflections {
+		delay := int(math.Round(reflection.DelaySec * float64(sampleRate)))
+		if delay < 0 {
+			continue
+		}
+		for i := delay; i < len(samples); i++ {
+			reflected[i] += samples[i-delay] * reflection.Gain
+		}
+	}
+	return reflected
+}
+
+// ApplyReverbAutomated works like ApplyReverb, but the dry/wet mix follows the given automation over time,
+// which makes it possible to let the reverb swell or fade. The mix values are clamped to the [0, 1] range.
+func ApplyReverbAutomated(samples []float64, sampleRate int, delayTimes, decays []float64, mixAutomation *Automation) ([]float64, error) {
+	if err := validateReverb(sampleRate, delayTimes, decays); err != nil {
+		return nil, err
+	}
+	wet := audioeffects.Reverb(samples, sampleRate, delayTimes, decays, 1.0)
+	reverbed := make([]float64, len(samples))
+	for i, sample := range samples {
+		mix := clampUnit(mixAutomation.ValueAt(float64(i) / float64(sampleRate)))
+		reverbed[i] = sample*(1-mix) + wet[i]*mix
+	}
+	return reverbed, nil
+}
+
+// AppendReverbTail extends the samples by tailSec seconds and fills the extension with a reverb of the samples,
+// where the feedback of the comb filters is set so that the reverb decays by 60 dB over tailSec seconds.
+// The very end of the tail is faded out, so that it decays smoothly to silence.
+func AppendReverbTail(samples []float64, tailSec float64, sampleRate int) []float64 {
+	tailLength := int(tailSec * float64(sampleRate))
+	extended := make([]float64, len(samples)+tailLength)
+	copy(extended, samples)
+	if tailLength <= 0 {
+		return extended
+	}
+	// Mutually prime delays, in seconds, for a dense and even decay
+	combDelays := []float64{0.0297, 0.0371, 0.0411, 0.0437}
+	allPassDelays := []float64{0.005, 0.0017}
+	wet := make([]float64, len(extended))
+	for _, delaySec := range combDelays {
+		delay := max(int(delaySec*float64(sampleRate)), 1)
+		feedback := math.Pow(0.001, delaySec/tailSec)
+		buffer := make([]float64, delay)
+		for i, sample := range extended {
+			out := buffer[i%delay]
+			buffer[i%delay] = sample + out*feedback
+			wet[i] += out / float64(len(combDelays))
+		}
+	}
+	for _, delaySec := range allPassDelays {
+		delay := max(int(delaySec*float64(sampleRate)), 1)
+		buffer := make([]float64, delay)
+		for i, sample := range wet {
+			out := buffer[i%delay]
+			buffer[i%delay] = sample + out*0.5
+			wet[i] = out - 0.5*buffer[i%delay]
+		}
+	}
+	fadeLength := tailLength / 4
+	for i := range extended {
+		gain := 1.0
+		if remaining := len(extended) - i; remaining < fadeLength {
+			gain = 0.5 - 0.5*math.Cos(math.Pi*float64(remaining)/float64(fadeLength))
+		}
+		extended[i] += wet[i] * gain
+	}
+	return extended
 }
 
 // ApplyCompressor applies dynamic range compression to the samples using the audioeffects package.
@@ -97,8 +449,133 @@ func ApplyNormalize(samples []float64, targetPeak float64) []float64 {
 // delayTimeLeft and delayTimeRight specify delay times for each channel in seconds.
 // feedback controls the amount of delayed signal fed back into the delay line.
 // mix determines the blend between dry and wet signals.
-func ApplyStereoDelay(left, right []float64, sampleRate int, delayTimeLeft, delayTimeRight, feedback, mix float64) ([]float64, []float64) {
-	return audioeffects.StereoDelay(left, right, sampleRate, delayTimeLeft, delayTimeRight, feedback, mix)
+// If pingPong is true, the feedback of each channel is routed into the opposite channel, for a bouncing echo.
+func ApplyStereoDelay(left, right []float64, sampleRate int, delayTimeLeft, delayTimeRight, feedback, mix float64, pingPong bool) ([]float64, []float64) {
+	if !pingPong {
+		return audioeffects.StereoDelay(left, right, sampleRate, delayTimeLeft, delayTimeRight, feedback, mix)
+	}
+	bufferLeft := make([]float64, max(int(delayTimeLeft*float64(sampleRate)), 1))
+	bufferRight := make([]float64, max(int(delayTimeRight*float64(sampleRate)), 1))
+	length := min(len(left), len(right))
+	delayedLeft := make([]float64, length)
+	delayedRight := make([]float64, length)
+	for i := 0; i < length; i++ {
+		indexLeft, indexRight := i%len(bufferLeft), i%len(bufferRight)
+		fromLeft, fromRight := bufferLeft[indexLeft], bufferRight[indexRight]
+		delayedLeft[i] = left[i]*(1-mix) + fromLeft*mix
+		delayedRight[i] = right[i]*(1-mix) + fromRight*mix
+		bufferLeft[indexLeft] = left[i] + fromRight*feedback
+		bufferRight[indexRight] = right[i] + fromLeft*feedback
+	}
+	return delayedLeft, delayedRight
+}
+
+// NoteDivision is a note length as a fraction of a whole note, like 1.0/8 for an eighth note
+type NoteDivision float64
+
+// Dotted returns the dotted note, which is one and a half times as long
+func (d NoteDivision) Dotted() NoteDivision {
+	return d * 1.5
+}
+
+// Triplet returns the triplet note, which is two thirds as long
+func (d NoteDivision) Triplet() NoteDivision {
+	return d * 2 / 3
+}
+
+// Seconds returns the length of the note at the given tempo, where a beat is a quarter note
+func (d NoteDivision) Seconds(bpm float64) float64 {
+	return float64(d) * 4 * 60 / bpm
+}
+
+// ApplyTempoDelay applies a delay that is synced to the tempo, where the delay time is the given note division
+// at the given BPM. feedback controls the amount of delayed signal fed back into the delay line, and mix
+// determines the blend between dry and wet signals.
+func ApplyTempoDelay(samples []float64, bpm float64, division NoteDivision, feedback, mix float64, sampleRate int) []float64 {
+	buffer := make([]float64, max(int(division.Seconds(bpm)*float64(sampleRate)), 1))
+	delayed := make([]float64, len(samples))
+	for i, sample := range samples {
+		index := i % len(buffer)
+		echo := buffer[index]
+		delayed[i] = sample*(1-mix) + echo*mix
+		buffer[index] = sample + echo*feedback
+	}
+	return delayed
+}
+
+// ApplyTempoDelayStereo works like ApplyTempoDelay, but for a left and a right channel with independent note
+// divisions, like a dotted eighth on the left and an eighth on the right, for a classic dub echo
+func ApplyTempoDelayStereo(left, right []float64, bpm float64, leftDivision, rightDivision NoteDivision, feedback, mix float64, sampleRate int) ([]float64, []float64) {
+	return ApplyTempoDelay(left, bpm, leftDivision, feedback, mix, sampleRate), ApplyTempoDelay(right, bpm, rightDivision, feedback, mix, sampleRate)
+}
+
+// crossfeedDelay is the delay, in seconds, of the sound that leaks over to the other ear
+const crossfeedDelay = 0.0003
+
+// crossfeedCutoff is the cutoff frequency of the low-pass filter on the sound that leaks over to the other ear
+const crossfeedCutoff = 700.0
+
+// ApplyCrossfeed blends a low-passed and slightly delayed portion of each channel into the other channel,
+// like the sound that reaches the opposite ear from a pair of speakers, which makes hard-panned stereo less
+// tiring to listen to on headphones. An amount of 0 leaves the channels unchanged, and 1 gives a leak at
+// full level, below the cutoff frequency.
+func ApplyCrossfeed(left, right []float64, amount float64, sampleRate int) (outL, outR []float64) {
+	amount = clampUnit(amount)
+	delay := int(crossfeedDelay * float64(sampleRate))
+	length := max(len(left), len(right))
+	leak := func(samples []float64) []float64 {
+		var f biquad
+		f.setFirstOrder(crossfeedCutoff, false, sampleRate)
+		leaked := make([]float64, length)
+		for i := range leaked {
+			x := 0.0
+			if j := i - delay; j >= 0 && j < len(samples) {
+				x = samples[j]
+			}
+			leaked[i] = amount * f.process(x)
+		}
+		return leaked
+	}
+	fromLeft, fromRight := leak(left), leak(right)
+	outL = make([]float64, length)
+	outR = make([]float64, length)
+	// Scale the output down, so that the level of a centered signal stays the same
+	gain := 1 / (1 + amount)
+	for i := 0; i < length; i++ {
+		l, r := 0.0, 0.0
+		if i < len(left) {
+			l = left[i]
+		}
+		if i < len(right) {
+			r = right[i]
+		}
+		outL[i] = (l + fromRight[i]) * gain
+		outR[i] = (r + fromLeft[i]) * gain
+	}
+	return outL, outR
+}
+
+// ApplyStereoRotation rotates the stereo image by the given angle, in degrees, by turning the left/right
+// vector towards the other channel. 0° leaves the channels unchanged, 45° sums both channels to the center
+// and 90° swaps the channels.
+func ApplyStereoRotation(left, right []float64, angleDeg float64) (outL, outR []float64) {
+	angle := angleDeg * math.Pi / 180
+	c, s := math.Cos(angle), math.Sin(angle)
+	length := max(len(left), len(right))
+	outL = make([]float64, length)
+	outR = make([]float64, length)
+	for i := 0; i < length; i++ {
+		l, r := 0.0, 0.0
+		if i < len(left) {
+			l = left[i]
+		}
+		if i < len(right) {
+			r = right[i]
+		}
+		outL[i] = c*l + s*r
+		outR[i] = s*l + c*r
+	}
+	return outL, outR
 }
 
 // ApplyBitcrusher applies a bitcrusher effect to the samples using the audioeffects package.
@@ -108,6 +585,228 @@ func ApplyBitcrusher(samples []float64, bitDepth, sampleRateReduction int) []flo
 	return audioeffects.Bitcrusher(samples, bitDepth, sampleRateReduction)
 }
 
+// ApplyStereoChorus applies a chorus effect and returns a left and a right channel, where the delay
+// modulation of the right channel is a quarter of a period behind the left channel, for a wide stereo image.
+// The parameters are the same as for ApplyChorus.
+func ApplyStereoChorus(samples []float64, sampleRate int, delaySec, depth, rate, mix float64) (left, right []float64) {
+	left = chorusChannel(samples, sampleRate, delaySec, depth, rate, mix, 0)
+	right = chorusChannel(samples, sampleRate, delaySec, depth, rate, mix, 0.25)
+	return left, right
+}
+
+// FlangerStereo applies a flanger to a stereo signal, with interpolated fractional delays for a smooth sweep,
+// and LFOs in anti-phase for the two channels. baseDelay and modDepth are given in seconds, modRate in Hz,
+// feedback (below 1) controls the resonance of the comb filter and mix blends between the dry and wet signals.
+func FlangerStereo(left, right []float64, baseDelay, modDepth, modRate, feedback, mix float64, sampleRate int) ([]float64, []float64) {
+	return flangerChannel(left, baseDelay, modDepth, modRate, feedback, mix, 0, sampleRate),
+		flangerChannel(right, baseDelay, modDepth, modRate, feedback, mix, 0.5, sampleRate)
+}
+
+// flangerChannel applies a flanger with an interpolated delay line, where lfoPhase is the start phase of the LFO,
+// as a fraction of a period
+func flangerChannel(samples []float64, baseDelay, modDepth, modRate, feedback, mix, lfoPhase float64, sampleRate int) []float64 {
+	flanged := make([]float64, len(samples))
+	line := make([]float64, len(samples)) // the input plus the feedback
+	for i, sample := range samples {
+		lfoValue := math.Sin(2 * math.Pi * (lfoPhase + modRate*float64(i)/float64(sampleRate)))
+		// The delay is at least one sample, since the delay line is only written up to the previous sample
+		pos := float64(i) - math.Max(1, (baseDelay+modDepth*lfoValue)*float64(sampleRate))
+		delayed := 0.0
+		if index := int(math.Floor(pos)); index >= 0 {
+			fraction := pos - float64(index)
+			delayed = line[index]*(1-fraction) + line[index+1]*fraction
+		}
+		line[i] = sample + delayed*feedback
+		flanged[i] = sample*(1-mix) + delayed*mix
+	}
+	return flanged
+}
+
+// chorusChannel applies a chorus with an interpolated, modulated delay, where lfoPhase is the start phase
+// of the LFO, as a fraction of a period
+func chorusChannel(samples []float64, sampleRate int, delaySec, depth, rate, mix, lfoPhase float64) []float64 {
+	chorused := make([]float64, len(samples))
+	for i, sample := range samples {
+		lfoValue := math.Sin(2 * math.Pi * (lfoPhase + rate*float64(i)/float64(sampleRate)))
+		delaySamples := math.Max(0, (delaySec+depth*lfoValue)*float64(sampleRate))
+		pos := float64(i) - delaySamples
+		delayed := 0.0
+		if index := int(math.Floor(pos)); index >= 0 {
+			fraction := pos - float64(index)
+			delayed = samples[index] * (1 - fraction)
+			if index+1 < len(samples) {
+				delayed += samples[index+1] * fraction
+			}
+		}
+		chorused[i] = sample*(1-mix) + delayed*mix
+	}
+	return chorused
+}
+
+// DeClick smooths out the discontinuities (clicks) at the given positions, for example at the seams where
+// samples have been cut or concatenated. The jump between the sample before and the sample at each position,
+// minus the expected slope of the waveform, is spread out over windowSamples samples on each side of the
+// position, with a raised cosine curve, so that the rest of the samples are left unchanged.
+func DeClick(samples []float64, positions []int, windowSamples int) []float64 {
+	declicked := make([]float64, len(samples))
+	copy(declicked, samples)
+	windowSamples = max(1, windowSamples)
+	for _, p := range positions {
+		if p < 2 || p+1 >= len(declicked) {
+			continue
+		}
+		slope := (declicked[p-1] - declicked[p-2] + declicked[p+1] - declicked[p]) / 2
+		jump := declicked[p] - declicked[p-1] - slope
+		start, end := max(p-windowSamples, 0), min(p+windowSamples, len(declicked))
+		for i := start; i < end; i++ {
+			blend := 0.5 - 0.5*math.Cos(math.Pi*float64(i-start)/float64(end-start))
+			if i >= p {
+				blend--
+			}
+			declicked[i] += jump * blend
+		}
+	}
+	return declicked
+}
+
+// RepairClicks finds and repairs impulsive glitches, like single-sample spikes from a bad conversion, for
+// cleaning up loaded WAV files before mixing. A sample is a glitch if it is further away from the line between
+// its two neighbors than thresholdFactor times the median distance for all samples (but at least one 16-bit
+// step). Glitches are replaced by linear interpolation between the neighbors, and all other samples are kept.
+// See DeClick for smoothing out discontinuities at known positions instead.
+func RepairClicks(samples []float64, thresholdFactor float64) []float64 {
+	repaired := make([]float64, len(samples))
+	copy(repaired, samples)
+	if len(samples) < 3 {
+		return repaired
+	}
+	residuals := make([]float64, len(samples))
+	for i := 1; i < len(samples)-1; i++ {
+		residuals[i] = math.Abs(samples[i] - (samples[i-1]+samples[i+1])/2)
+	}
+	sorted := append([]float64(nil), residuals[1:len(samples)-1]...)
+	sort.Float64s(sorted)
+	threshold := thresholdFactor * math.Max(sorted[len(sorted)/2], 1.0/32768)
+	for i := 1; i < len(samples)-1; i++ {
+		// A spike also throws off the residuals of its neighbors, so only repair the local maximum
+		if residuals[i] > threshold && residuals[i] >= residuals[i-1] && residuals[i] >= residuals[i+1] {
+			repaired[i] = (repaired[i-1] + samples[i+1]) / 2
+		}
+	}
+	return repaired
+}
+
+// CleanTail fades out the end of the samples with a smooth raised cosine curve that ends at exactly 0, over fadeSec seconds.
+// TPDF dither at the level of one 16-bit step is added to the faded part before the fade is applied, so that the
+// low level tail does not turn into crackling quantization distortion when exported. The dither uses a fixed seed,
+// so the same samples always give the same output.
+func CleanTail(samples []float64, fadeSec float64, sampleRate int) []float64 {
+	const ditherStep = 1.0 / 32768
+	cleaned := append([]float64(nil), samples...)
+	fadeSamples := min(int(fadeSec*float64(sampleRate)), len(cleaned))
+	if fadeSamples <= 0 {
+		return cleaned
+	}
+	r := rand.New(rand.NewSource(1))
+	start := len(cleaned) - fadeSamples
+	for i := start; i < len(cleaned); i++ {
+		progress := float64(i-start+1) / float64(fadeSamples)
+		gain := 0.5 + 0.5*math.Cos(math.Pi*progress)
+		dither := (r.Float64() - r.Float64()) * ditherStep
+		cleaned[i] = (cleaned[i] + dither) * gain
+	}
+	return cleaned
+}
+
+// Blend crossfades between the dry and the wet samples, where a mix of 0 gives only the dry signal and 1 gives
+// only the wet signal. If one slice is shorter than the other, it is treated as silence past its end.
+func Blend(dry, wet []float64, mix float64) []float64 {
+	mix = clampUnit(mix)
+	blended := make([]float64, max(len(dry), len(wet)))
+	for i := range blended {
+		var d, w float64
+		if i < len(dry) {
+			d = dry[i]
+		}
+		if i < len(wet) {
+			w = wet[i]
+		}
+		blended[i] = d*(1-mix) + w*mix
+	}
+	return blended
+}
+
+// WithMix wraps an effect function so that its output is blended with the unprocessed input, which adds a
+// dry/wet control to effects that lack one (like filters, drive and bitcrushing). A mix of 0 bypasses the effect.
+func WithMix(fn func([]float64) []float64, mix float64) func([]float64) []float64 {
+	return func(samples []float64) []float64 {
+		if mix <= 0 {
+			return append([]float64(nil), samples...)
+		}
+		return Blend(samples, fn(samples), mix)
+	}
+}
+
+// BitcrusherDithered works like ApplyBitcrusher, but adds triangular (TPDF) dither of one quantization step
+// before quantizing, which turns the correlated distortion of the plain bitcrusher into a steady noise floor
+func BitcrusherDithered(samples []float64, bitDepth, sampleRateReduction int) []float64 {
+	bitDepth = max(1, min(bitDepth, 16))
+	sampleRateReduction = max(1, sampleRateReduction)
+	step := 1.0 / math.Pow(2, float64(bitDepth))
+	bitcrushed := make([]float64, len(samples))
+	var currentSample float64
+	for i, sample := range samples {
+		if i%sampleRateReduction == 0 {
+			dither := (rand.Float64() - rand.Float64()) * step
+			currentSample = math.Max(-1, math.Min(1, math.Round((sample+dither)/step)*step))
+		}
+		bitcrushed[i] = currentSample
+	}
+	return bitcrushed
+}
+
+// BeatRepeat is a stutter effect that grabs the first sliceSec seconds of the samples and repeats it the given
+// number of times, every repeatSec seconds, before the rest of the samples continue in time. Each repeat is cut
+// off at the start of the next one. Slice the samples first to stutter from another position. The length of
+// the samples is kept.
+func BeatRepeat(samples []float64, sliceSec, repeatSec float64, repeats int, sampleRate int) []float64 {
+	repeated := make([]float64, len(samples))
+	copy(repeated, samples)
+	sliceLength := min(int(sliceSec*float64(sampleRate)), len(samples))
+	interval := int(repeatSec * float64(sampleRate))
+	if sliceLength <= 0 || interval <= 0 || repeats <= 0 {
+		return repeated
+	}
+	stutterEnd := min(repeats*interval, len(samples))
+	for i := 0; i < stutterEnd; i++ {
+		if pos := i % interval; pos < sliceLength {
+			repeated[i] = samples[pos]
+		} else {
+			repeated[i] = 0
+		}
+	}
+	return repeated
+}
+
+// Decimate reduces the sample rate by keeping every factor-th sample, for a lo-fi effect, while the length
+// stays the same. If interpolate is false, each kept sample is held until the next one, which gives a stairstep,
+// like a sample-and-hold circuit. If interpolate is true, there are straight lines between the kept samples
+// instead, which gives a smoother sound with less high frequency aliasing.
+func Decimate(samples []float64, factor int, interpolate bool) []float64 {
+	factor = max(1, factor)
+	decimated := make([]float64, len(samples))
+	for i := range samples {
+		held := i - i%factor
+		if !interpolate || held+factor >= len(samples) {
+			decimated[i] = samples[held]
+			continue
+		}
+		x := float64(i-held) / float64(factor)
+		decimated[i] = samples[held]*(1-x) + samples[held+factor]*x
+	}
+	return decimated
+}
+
 // ApplySoftClipping applies soft clipping distortion to the samples using the audioeffects package.
 func ApplySoftClipping(samples []float64, drive float64) []float64 {
 	return audioeffects.SoftClippingDistortion(samples, drive)
@@ -142,8 +841,30 @@ func ApplyPhaser(samples []float64, sampleRate int, rate, depth, feedback float6
 // threshold sets the compression threshold.
 // ratio determines the compression ratio.
 // attack and release control the compressor's responsiveness.
-func ApplySidechainCompressor(target, trigger []float64, threshold, ratio, attack, release float64, sampleRate int) []float64 {
-	return audioeffects.SidechainCompressor(target, trigger, threshold, ratio, attack, release, sampleRate)
+// Returns an error if the target and the trigger are not of the same length.
+func ApplySidechainCompressor(target, trigger []float64, threshold, ratio, attack, release float64, sampleRate int) ([]float64, error) {
+	if len(target) != len(trigger) {
+		return nil, fmt.Errorf("the target and the trigger must be of the same length, got %d and %d samples", len(target), len(trigger))
+	}
+	return audioeffects.SidechainCompressor(target, trigger, threshold, ratio, attack, release, sampleRate), nil
+}
+
+// DuckBy is a simple sidechain ducker: the target (like a bass) is pushed down by amount (0 to 1) whenever
+// the trigger (like a kick) is loud, and recovers over releaseSec seconds. The trigger level is followed
+// with a fast attack, so the ducking starts right at the trigger onsets.
+func DuckBy(target, trigger []float64, amount, releaseSec float64, sampleRate int) []float64 {
+	amount = clampUnit(amount)
+	envelope := EnvelopeFollower(trigger, 0.001, releaseSec, sampleRate)
+	peak := FindPeakAmplitude(envelope)
+	ducked := make([]float64, len(target))
+	for i, sample := range target {
+		level := 0.0
+		if i < len(envelope) && peak > 0 {
+			level = envelope[i] / peak
+		}
+		ducked[i] = sample * (1 - amount*level)
+	}
+	return ducked
 }
 
 // ApplyNoiseGate applies a noise gate to the samples using the audioeffects package.
@@ -156,6 +877,7 @@ func ApplyNoiseGate(samples []float64, threshold, attack, release float64, sampl
 // ApplyMultibandCompression applies multiband compression to the samples using the audioeffects package.
 // bands defines the frequency ranges for each band.
 // compressors defines the compression settings for each band.
+// Returns an error if there is not one compressor per band.
 func ApplyMultibandCompression(samples []float64, bands []struct {
 	Low  float64
 	High float64
@@ -164,8 +886,14 @@ func ApplyMultibandCompression(samples []float64, bands []struct {
 	Ratio     float64
 	Attack    float64
 	Release   float64
-}, sampleRate int) []float64 {
-	return audioeffects.MultibandCompression(samples, bands, compressors, sampleRate)
+}, sampleRate int) ([]float64, error) {
+	if len(bands) != len(compressors) {
+		return nil, fmt.Errorf("expected one compressor per band, got %d bands and %d compressors", len(bands), len(compressors))
+	}
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate: %d", sampleRate)
+	}
+	return audioeffects.MultibandCompression(samples, bands, compressors, sampleRate), nil
 }
 
 // ApplyGranularSynthesis applies granular synthesis to the samples using the audioeffects package.
@@ -193,6 +921,19 @@ func ApplyAddPartials(duration, amplitude, frequency float64, partials, ampEnv [
 	return audioeffects.AddPartials(duration, amplitude, frequency, partials, ampEnv, sampleRate)
 }
 
+// ApplyInharmonicity stretches (or compresses) the frequencies of the given partials, which are frequency ratio
+// and amplitude pairs, like for ApplyAddPartials. Each frequency ratio is raised to the power of stretchFactor,
+// so that a factor above 1 makes the higher partials progressively sharper, like the stiff strings of a piano,
+// while a factor below 1 makes them flatter. A factor of 1 leaves the partials harmonic. The amplitudes are kept.
+func ApplyInharmonicity(partials []float64, stretchFactor float64) []float64 {
+	stretched := make([]float64, len(partials))
+	copy(stretched, partials)
+	for j := 0; j+1 < len(stretched); j += 2 {
+		stretched[j] = math.Copysign(math.Pow(math.Abs(partials[j]), stretchFactor), partials[j])
+	}
+	return stretched
+}
+
 // ApplySubtractOp subtracts noise from the samples using the audioeffects package.
 // duration specifies the noise duration in seconds.
 // amplitude sets the noise amplitude.
@@ -0,0 +1,39 @@
+package synth
+
+import (
+	"math"
+)
+
+// sineTableSize is the number of entries in the sine lookup table, for one full cycle
+const sineTableSize = 4096
+
+// sineTable holds one full cycle of a sine wave, plus one extra entry for the interpolation at the end
+var sineTable = func() []float64 {
+	table := make([]float64, sineTableSize+1)
+	for i := range table {
+		table[i] = math.Sin(2 * math.Pi * float64(i) / sineTableSize)
+	}
+	return table
+}()
+
+// fastSin returns an approximation of math.Sin(phase), by interpolating linearly in a precomputed table.
+// The error is below 1e-6, which is well below what can be heard, even at 24 bits.
+func fastSin(phase float64) float64 {
+	if math.IsNaN(phase) || math.IsInf(phase, 0) {
+		return math.NaN()
+	}
+	position := phase / (2 * math.Pi)
+	position -= math.Floor(position)
+	position *= sineTableSize
+	index := int(position)
+	fraction := position - float64(index)
+	return sineTable[index] + (sineTable[index+1]-sineTable[index])*fraction
+}
+
+// sin returns the sine of x, using the lookup table if FastMath is enabled
+func (cfg *Settings) sin(x float64) float64 {
+	if cfg.FastMath {
+		return fastSin(x)
+	}
+	return math.Sin(x)
+}
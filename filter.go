@@ -0,0 +1,299 @@
+package synth
+
+import (
+	"math"
+	"math/cmplx"
+	"sort"
+)
+
+// biquad is a second order IIR filter, with coefficients from the Audio EQ Cookbook by Robert Bristow-Johnson
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+// setBandPass configures the biquad as a band-pass filter with a peak gain of 0 dB
+func (f *biquad) setBandPass(freq, q float64, sampleRate int) {
+	w0, alpha := biquadParams(freq, q, sampleRate)
+	a0 := 1 + alpha
+	f.b0 = alpha / a0
+	f.b1 = 0
+	f.b2 = -alpha / a0
+	f.a1 = -2 * math.Cos(w0) / a0
+	f.a2 = (1 - alpha) / a0
+}
+
+// setLowPass configures the biquad as a second order low-pass filter
+func (f *biquad) setLowPass(freq, q float64, sampleRate int) {
+	w0, alpha := biquadParams(freq, q, sampleRate)
+	cosW0 := math.Cos(w0)
+	a0 := 1 + alpha
+	f.b0 = (1 - cosW0) / 2 / a0
+	f.b1 = (1 - cosW0) / a0
+	f.b2 = (1 - cosW0) / 2 / a0
+	f.a1 = -2 * cosW0 / a0
+	f.a2 = (1 - alpha) / a0
+}
+
+// setHighPass configures the biquad as a second order high-pass filter
+func (f *biquad) setHighPass(freq, q float64, sampleRate int) {
+	w0, alpha := biquadParams(freq, q, sampleRate)
+	cosW0 := math.Cos(w0)
+	a0 := 1 + alpha
+	f.b0 = (1 + cosW0) / 2 / a0
+	f.b1 = -(1 + cosW0) / a0
+	f.b2 = (1 + cosW0) / 2 / a0
+	f.a1 = -2 * cosW0 / a0
+	f.a2 = (1 - alpha) / a0
+}
+
+// setPeaking configures the biquad as a peaking EQ filter that boosts or cuts gainDB around the given frequency
+func (f *biquad) setPeaking(freq, q, gainDB float64, sampleRate int) {
+	w0, alpha := biquadParams(freq, q, sampleRate)
+	a := math.Pow(10, gainDB/40)
+	a0 := 1 + alpha/a
+	f.b0 = (1 + alpha*a) / a0
+	f.b1 = -2 * math.Cos(w0) / a0
+	f.b2 = (1 - alpha*a) / a0
+	f.a1 = -2 * math.Cos(w0) / a0
+	f.a2 = (1 - alpha/a) / a0
+}
+
+// setResonator configures the biquad as a two-pole resonator that rings at the given frequency,
+// where decay is the time in seconds it takes for the ringing to fall by 60 dB
+func (f *biquad) setResonator(freq, decay float64, sampleRate int) {
+	w0, _ := biquadParams(freq, 1, sampleRate)
+	r := math.Pow(0.001, 1.0/(math.Max(decay, 1e-6)*float64(sampleRate)))
+	f.b0 = 1 - r
+	f.b1 = 0
+	f.b2 = 0
+	f.a1 = -2 * r * math.Cos(w0)
+	f.a2 = r * r
+}
+
+// setFirstOrder configures the biquad as a first order low-pass or high-pass filter, using the bilinear transform
+func (f *biquad) setFirstOrder(freq float64, highPass bool, sampleRate int) {
+	k := math.Tan(math.Pi * math.Min(freq, 0.45*float64(sampleRate)) / float64(sampleRate))
+	if highPass {
+		f.b0 = 1 / (1 + k)
+		f.b1 = -1 / (1 + k)
+	} else {
+		f.b0 = k / (1 + k)
+		f.b1 = k / (1 + k)
+	}
+	f.b2 = 0
+	f.a1 = (k - 1) / (1 + k)
+	f.a2 = 0
+}
+
+// magnitude returns the gain of the biquad at the given frequency
+func (f *biquad) magnitude(freq float64, sampleRate int) float64 {
+	z := cmplx.Exp(complex(0, -2*math.Pi*freq/float64(sampleRate))) // z^-1
+	numerator := complex(f.b0, 0) + complex(f.b1, 0)*z + complex(f.b2, 0)*z*z
+	denominator := 1 + complex(f.a1, 0)*z + complex(f.a2, 0)*z*z
+	return cmplx.Abs(numerator / denominator)
+}
+
+// process filters a single sample
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// biquadParams returns the angular frequency and alpha value for the given frequency and Q,
+// where the frequency is kept below the Nyquist frequency
+func biquadParams(freq, q float64, sampleRate int) (float64, float64) {
+	nyquist := float64(sampleRate) / 2
+	if freq > nyquist*0.95 {
+		freq = nyquist * 0.95
+	} else if freq < 1 {
+		freq = 1
+	}
+	if q <= 0 {
+		q = 0.0001
+	}
+	w0 := 2 * math.Pi * freq / float64(sampleRate)
+	return w0, math.Sin(w0) / (2 * q)
+}
+
+// PeakingEQ boosts (or cuts, for negative gainDB) the frequencies around freq, where q controls the bandwidth
+func PeakingEQ(samples []float64, freq, q, gainDB float64, sampleRate int) []float64 {
+	var f biquad
+	f.setPeaking(freq, q, gainDB, sampleRate)
+	equalized := make([]float64, len(samples))
+	for i, sample := range samples {
+		equalized[i] = f.process(sample)
+	}
+	return equalized
+}
+
+// linkwitzRiley4 applies a 4th order Linkwitz-Riley low-pass or high-pass filter,
+// which is two cascaded 2nd order Butterworth filters
+func linkwitzRiley4(samples []float64, freq float64, highPass bool, sampleRate int) []float64 {
+	var first, second biquad
+	if highPass {
+		first.setHighPass(freq, math.Sqrt2/2, sampleRate)
+		second.setHighPass(freq, math.Sqrt2/2, sampleRate)
+	} else {
+		first.setLowPass(freq, math.Sqrt2/2, sampleRate)
+		second.setLowPass(freq, math.Sqrt2/2, sampleRate)
+	}
+	filtered := make([]float64, len(samples))
+	for i, sample := range samples {
+		filtered[i] = second.process(first.process(sample))
+	}
+	return filtered
+}
+
+// LinkwitzRileyCrossover splits the samples into len(crossoverFreqs)+1 frequency bands, from low to high,
+// using 4th order Linkwitz-Riley filters. The bands sum back to a flat magnitude response, since the lower
+// bands are phase aligned with the higher crossovers, so they can be processed separately and then mixed.
+func LinkwitzRileyCrossover(samples []float64, crossoverFreqs []float64, sampleRate int) [][]float64 {
+	freqs := append([]float64(nil), crossoverFreqs...)
+	sort.Float64s(freqs)
+	bands := make([][]float64, 0, len(freqs)+1)
+	rest := samples
+	for i, freq := range freqs {
+		band := linkwitzRiley4(rest, freq, false, sampleRate)
+		// Pass the band through the all-pass response of each higher crossover, to keep the phase aligned
+		for _, higher := range freqs[i+1:] {
+			low := linkwitzRiley4(band, higher, false, sampleRate)
+			high := linkwitzRiley4(band, higher, true, sampleRate)
+			for j := range band {
+				band[j] = low[j] + high[j]
+			}
+		}
+		bands = append(bands, band)
+		rest = linkwitzRiley4(rest, freq, true, sampleRate)
+	}
+	bands = append(bands, append([]float64(nil), rest...))
+	return bands
+}
+
+// ResonantHighPassFilter applies a steep (12 dB per octave) high-pass filter, where resonance is the Q of the filter.
+// A resonance of 0.707 gives a flat response, and higher values give a resonant bump at the cutoff frequency.
+func ResonantHighPassFilter(samples []float64, cutoff, resonance float64, sampleRate int) []float64 {
+	var f biquad
+	f.setHighPass(cutoff, resonance, sampleRate)
+	filtered := make([]float64, len(samples))
+	for i, sample := range samples {
+		filtered[i] = f.process(sample)
+	}
+	return filtered
+}
+
+// ApplyExciter adds presence by generating harmonics from the frequencies above crossoverHz and mixing them back
+// in, scaled by amount. The high frequencies are saturated, and the result is high-passed again, so that the
+// frequencies below the crossover are left unchanged.
+func ApplyExciter(samples []float64, amount float64, crossoverHz float64, sampleRate int) []float64 {
+	var highPass, harmonicsHighPass biquad
+	highPass.setHighPass(crossoverHz, math.Sqrt2/2, sampleRate)
+	harmonicsHighPass.setHighPass(crossoverHz, math.Sqrt2/2, sampleRate)
+	excited := make([]float64, len(samples))
+	for i, sample := range samples {
+		high := highPass.process(sample)
+		// The tanh saturation adds odd harmonics, and the squared term adds even harmonics
+		harmonics := math.Tanh(2*high) + high*high
+		excited[i] = sample + amount*harmonicsHighPass.process(harmonics)
+	}
+	return excited
+}
+
+// SpeakerSim approximates the frequency response of a small speaker, like the one in a phone, for previewing
+// how a sound translates. Everything below 150 Hz is cut steeply (24 dB per octave), the frequencies above
+// 5 kHz are rolled off, and there is a bump in the mids, around 1.5 kHz.
+func SpeakerSim(samples []float64, sampleRate int) []float64 {
+	sections := make([]biquad, 4)
+	sections[0].setHighPass(150, math.Sqrt2/2, sampleRate)
+	sections[1].setHighPass(150, math.Sqrt2/2, sampleRate)
+	sections[2].setLowPass(5000, math.Sqrt2/2, sampleRate)
+	sections[3].setPeaking(1500, 1.0, 4, sampleRate)
+	simulated := make([]float64, len(samples))
+	for i, sample := range samples {
+		for j := range sections {
+			sample = sections[j].process(sample)
+		}
+		simulated[i] = sample
+	}
+	return simulated
+}
+
+// EnvelopeFollower returns the amplitude envelope of the samples, using separate attack and release times in seconds
+func EnvelopeFollower(samples []float64, attack, release float64, sampleRate int) []float64 {
+	envelope := make([]float64, len(samples))
+	attackCoeff := math.Exp(-1.0 / (math.Max(attack, 1e-6) * float64(sampleRate)))
+	releaseCoeff := math.Exp(-1.0 / (math.Max(release, 1e-6) * float64(sampleRate)))
+	level := 0.0
+	for i, sample := range samples {
+		abs := math.Abs(sample)
+		if abs > level {
+			level = attackCoeff*level + (1-attackCoeff)*abs
+		} else {
+			level = releaseCoeff*level + (1-releaseCoeff)*abs
+		}
+		envelope[i] = level
+	}
+	return envelope
+}
+
+// EnvelopeFilter applies an envelope filter (auto-wah), where the amplitude envelope of the samples
+// sweeps the center frequency of a resonant band-pass filter upwards from baseCutoff.
+// A sensitivity of 1 lets a full scale signal sweep the filter 4 octaves up.
+func EnvelopeFilter(samples []float64, baseCutoff, sensitivity float64, sampleRate int) []float64 {
+	const q = 4.0
+	envelope := EnvelopeFollower(samples, 0.005, 0.1, sampleRate)
+	filtered := make([]float64, len(samples))
+	var f biquad
+	for i, sample := range samples {
+		cutoff := baseCutoff * math.Pow(2, 4*sensitivity*envelope[i])
+		f.setBandPass(cutoff, q, sampleRate)
+		filtered[i] = f.process(sample)
+	}
+	return filtered
+}
+
+// aWeightingSections returns the cascade of first order filters that make up the A-weighting curve from
+// IEC 61672, with poles at 20.6 Hz (twice), 107.7 Hz, 737.9 Hz and 12194 Hz (twice)
+func aWeightingSections(sampleRate int) []biquad {
+	sections := make([]biquad, 6)
+	sections[0].setFirstOrder(20.6, true, sampleRate)
+	sections[1].setFirstOrder(20.6, true, sampleRate)
+	sections[2].setFirstOrder(107.7, true, sampleRate)
+	sections[3].setFirstOrder(737.9, true, sampleRate)
+	sections[4].setFirstOrder(12194, false, sampleRate)
+	sections[5].setFirstOrder(12194, false, sampleRate)
+	return sections
+}
+
+// AWeighting applies an A-weighting filter to the samples, which approximates how sensitive the ear is to
+// different frequencies at moderate levels. The gain is normalized to 0 dB at 1 kHz.
+func AWeighting(samples []float64, sampleRate int) []float64 {
+	sections := aWeightingSections(sampleRate)
+	gain := 1.0
+	for i := range sections {
+		gain /= sections[i].magnitude(1000, sampleRate)
+	}
+	weighted := make([]float64, len(samples))
+	for i, sample := range samples {
+		for j := range sections {
+			sample = sections[j].process(sample)
+		}
+		weighted[i] = sample * gain
+	}
+	return weighted
+}
+
+// AWeightedRMS returns the RMS of the samples after A-weighting, which reflects the perceived loudness
+// better than the flat RMS
+func AWeightedRMS(samples []float64, sampleRate int) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, sample := range AWeighting(samples, sampleRate) {
+		sum += sample * sample
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
@@ -1,9 +1,12 @@
 package synth
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
+	"sort"
+	"sync/atomic"
 )
 
 // GenerateClap generates a clap sound by combining filtered noise bursts
@@ -17,31 +20,51 @@ func (cfg *Settings) GenerateClap() ([]float64, error) {
 	delayBetweenBursts := 0.02 // 20ms between bursts
 	burstDuration := (cfg.Duration - (float64(burstCount-1) * delayBetweenBursts)) / float64(burstCount)
 
+	gains, cutoffs := cfg.clapBurstDrift(burstCount)
+	r := cfg.noiseSource()
+
 	for burst := 0; burst < burstCount; burst++ {
 		startIndex := int(float64(burst) * delayBetweenBursts * float64(cfg.SampleRate))
 		burstSamples := int(burstDuration * float64(cfg.SampleRate))
 
 		// Generate filtered white noise for each burst
-		burstNoise := GenerateWhiteNoise(burstSamples, cfg.NoiseAmount)
-		burstNoise = LowPassFilter(burstNoise, cfg.FilterCutoff, cfg.SampleRate)
+		burstNoise := whiteNoise(r, burstSamples, cfg.NoiseAmount)
+		burstNoise = LowPassFilter(burstNoise, cutoffs[burst], cfg.SampleRate)
 
 		// Apply ADSR envelope to each burst
-		burstNoise = ApplyEnvelope(burstNoise, cfg.Attack, cfg.Decay, cfg.Sustain, cfg.Release, cfg.SampleRate)
+		burstNoise = cfg.applyNoiseEnvelope(burstNoise)
 
 		// Mix the bursts into the final sample array
 		for i := 0; i < burstSamples; i++ {
 			if startIndex+i < numSamples {
-				samples[startIndex+i] += burstNoise[i]
+				samples[startIndex+i] += burstNoise[i] * gains[burst]
 			}
 		}
 	}
 
 	// Apply limiter to ensure the final clap sound is within [-1, 1]
-	samples = Limiter(samples)
+	samples = cfg.postProcess(samples)
 
 	return samples, nil
 }
 
+// clapBurstDrift returns the gain and the filter cutoff frequency for each of the noise bursts of a clap.
+// With ClapDrift set, the gains vary by up to ClapDrift (as a fraction) and the cutoff frequencies by up to
+// ClapDrift octaves, randomly (see randomSource), like the bursts of an analog clap circuit.
+func (cfg *Settings) clapBurstDrift(burstCount int) (gains, cutoffs []float64) {
+	gains = make([]float64, burstCount)
+	cutoffs = make([]float64, burstCount)
+	r := cfg.randomSource()
+	for burst := range gains {
+		gains[burst], cutoffs[burst] = 1, cfg.FilterCutoff
+		if cfg.ClapDrift > 0 {
+			gains[burst] = math.Max(1+cfg.ClapDrift*(2*r.Float64()-1), 0)
+			cutoffs[burst] *= math.Pow(2, cfg.ClapDrift*(2*r.Float64()-1))
+		}
+	}
+	return gains, cutoffs
+}
+
 // GenerateSnare generates a snare drum sound by combining noise and a tonal component
 func (cfg *Settings) GenerateSnare() ([]float64, error) {
 	numSamples := int(float64(cfg.SampleRate) * cfg.Duration)
@@ -50,58 +73,74 @@ func (cfg *Settings) GenerateSnare() ([]float64, error) {
 	// Generate the tonal part (body of the snare) using a short burst of a tuned waveform
 	tonalSamples := int(cfg.Duration * float64(cfg.SampleRate) * 0.3) // 30% of the duration is tonal
 	frequencyDecayFactor := 0.99                                      // Decay factor for pitch modulation
+	frequencies := cfg.frequencyTrajectory(tonalSamples)
 
 	for i := 0; i < tonalSamples; i++ {
 		t := float64(i) / float64(cfg.SampleRate)
-		frequency := cfg.StartFreq * math.Pow(cfg.EndFreq/cfg.StartFreq, t/cfg.Duration) * frequencyDecayFactor
+		frequency := frequencies[i] * frequencyDecayFactor
 		// Use a waveform type like Sawtooth or Square to generate the tonal body
 		var sample float64
 		switch cfg.WaveformType {
 		case WaveSine:
-			sample = math.Sin(2 * math.Pi * frequency * t)
+			sample = cfg.sin(2 * math.Pi * frequency * t)
 		case WaveTriangle:
 			sample = 2*math.Abs(2*(t*frequency-math.Floor(t*frequency+0.5))) - 1
 		case WaveSawtooth:
 			sample = 2 * (t*frequency - math.Floor(0.5+t*frequency))
 		case WaveSquare:
-			sample = math.Copysign(1.0, math.Sin(2*math.Pi*frequency*t))
+			sample = math.Copysign(1.0, cfg.sin(2*math.Pi*frequency*t))
 		default:
 			return nil, fmt.Errorf("unsupported waveform type: %d", cfg.WaveformType)
 		}
-		samples[i] += sample
+		samples[i] += cfg.retroSample(sample)
 	}
 
 	// Generate the noise part (snare "rattle") using filtered pink noise
-	noiseSamples := GeneratePinkNoise(numSamples, cfg.NoiseAmount)
+	noiseSamples := pinkNoise(cfg.noiseSource(), numSamples, cfg.NoiseAmount)
 	noiseSamples = BandPassFilter(noiseSamples, 150.0, 8000.0, cfg.SampleRate) // Bandpass to shape the noise
 
-	// Mix noise with the tonal part
-	for i := 0; i < numSamples; i++ {
-		samples[i] += noiseSamples[i]
+	// Mix noise with the tonal part, and apply the ADSR envelope to shape the sound
+	if cfg.NoiseEnvelope != nil {
+		samples = cfg.applyEnvelope(samples)
+		noiseSamples = cfg.applyNoiseEnvelope(noiseSamples)
+		for i := 0; i < numSamples; i++ {
+			samples[i] += noiseSamples[i]
+		}
+	} else {
+		for i := 0; i < numSamples; i++ {
+			samples[i] += noiseSamples[i]
+		}
+		samples = cfg.applyEnvelope(samples)
 	}
 
-	// Apply ADSR envelope to shape the sound
-	samples = ApplyEnvelope(samples, cfg.Attack, cfg.Decay, cfg.Sustain, cfg.Release, cfg.SampleRate)
-
 	// Apply drive (distortion) to add more punch to the snare
-	samples = Drive(samples, cfg.Drive)
+	samples = cfg.drive(samples)
 
 	// Apply limiter to keep everything within the [-1, 1] range
-	samples = Limiter(samples)
+	samples = cfg.postProcess(samples)
 
 	return samples, nil
 }
 
+// applyNoiseEnvelope applies the NoiseEnvelope to the noise component of a sound,
+// or the main envelope if no NoiseEnvelope is set
+func (cfg *Settings) applyNoiseEnvelope(samples []float64) []float64 {
+	if e := cfg.NoiseEnvelope; e != nil {
+		return ApplyEnvelope(samples, e.Attack, e.Decay, e.Sustain, e.Release, cfg.SampleRate)
+	}
+	return cfg.applyEnvelope(samples)
+}
+
 // GenerateClosedHH generates a closed hi-hat sound using filtered noise
 func (cfg *Settings) GenerateClosedHH() ([]float64, error) {
 	numSamples := int(float64(cfg.SampleRate) * cfg.Duration)
 	samples := make([]float64, numSamples)
 
 	// Generate the noise component (hi-hat is mostly metallic noise)
-	noiseSamples := GenerateWhiteNoise(numSamples, cfg.NoiseAmount)
+	noiseSamples := whiteNoise(cfg.noiseSource(), numSamples, cfg.NoiseAmount)
 
 	// Apply a high-pass filter to emphasize the high frequencies of the hi-hat sound
-	noiseSamples = HighPassFilter(noiseSamples, 5000.0, cfg.SampleRate) // Remove low frequencies below 5kHz
+	noiseSamples = HighPassFilter(noiseSamples, cfg.hatHighPassCutoff(), cfg.SampleRate) // Remove low frequencies below 5kHz (or higher for tight hats)
 
 	// Optionally, apply a band-pass filter to focus the hi-hat frequency range
 	noiseSamples = BandPassFilter(noiseSamples, 5000.0, 10000.0, cfg.SampleRate) // Focus on higher frequencies
@@ -112,16 +151,16 @@ func (cfg *Settings) GenerateClosedHH() ([]float64, error) {
 	}
 
 	// Apply a very short ADSR envelope to create the sharp, percussive nature of a closed hi-hat
-	samples = ApplyEnvelope(samples, cfg.Attack, cfg.Decay, cfg.Sustain, cfg.Release, cfg.SampleRate)
+	samples = cfg.applyEnvelope(samples)
 
-	// Add some drive (distortion) to give the hi-hat a metallic, sharp edge
-	samples = Drive(samples, cfg.Drive)
+	// Shorten the decay further according to how tight the hi-hat should be
+	samples = cfg.applyHatTightness(samples)
 
-	// Apply a fade-out to give the hi-hat a quick decay, typical of a closed hi-hat
-	samples = ApplyFadeOut(samples, cfg.FadeDuration, cfg.SampleRate)
+	// Add some drive (distortion) to give the hi-hat a metallic, sharp edge
+	samples = cfg.drive(samples)
 
-	// Limit the amplitude to avoid clipping
-	samples = Limiter(samples)
+	// Limit the amplitude to avoid clipping, and fade out the tail over FadeDuration
+	samples = cfg.postProcess(samples)
 
 	return samples, nil
 }
@@ -132,10 +171,10 @@ func (cfg *Settings) GenerateOpenHH() ([]float64, error) {
 	samples := make([]float64, numSamples)
 
 	// Generate the noise component (hi-hat is mostly metallic noise)
-	noiseSamples := GenerateWhiteNoise(numSamples, cfg.NoiseAmount)
+	noiseSamples := whiteNoise(cfg.noiseSource(), numSamples, cfg.NoiseAmount)
 
 	// Apply a high-pass filter to emphasize the high frequencies of the hi-hat sound
-	noiseSamples = HighPassFilter(noiseSamples, 5000.0, cfg.SampleRate) // Remove low frequencies below 5kHz
+	noiseSamples = HighPassFilter(noiseSamples, cfg.hatHighPassCutoff(), cfg.SampleRate) // Remove low frequencies below 5kHz (or higher for tight hats)
 
 	// Optionally, apply a band-pass filter to focus the hi-hat frequency range
 	noiseSamples = BandPassFilter(noiseSamples, 5000.0, 10000.0, cfg.SampleRate) // Focus on higher frequencies
@@ -146,92 +185,166 @@ func (cfg *Settings) GenerateOpenHH() ([]float64, error) {
 	}
 
 	// Apply a longer ADSR envelope to create the open, sustained nature of the open hi-hat
-	samples = ApplyEnvelope(samples, cfg.Attack, cfg.Decay, cfg.Sustain, cfg.Release, cfg.SampleRate)
+	samples = cfg.applyEnvelope(samples)
+
+	// Shorten the decay further according to how tight the hi-hat should be
+	samples = cfg.applyHatTightness(samples)
 
 	// Add some drive (distortion) to give the hi-hat a metallic, sharp edge
-	samples = Drive(samples, cfg.Drive)
+	samples = cfg.drive(samples)
 
-	// Apply a fade-out to simulate the natural decay of an open hi-hat
-	samples = ApplyFadeOut(samples, cfg.FadeDuration, cfg.SampleRate)
-
-	// Limit the amplitude to avoid clipping
-	samples = Limiter(samples)
+	// Limit the amplitude to avoid clipping, and fade out the tail over FadeDuration
+	samples = cfg.postProcess(samples)
 
 	return samples, nil
 }
 
+// hatHighPassCutoff returns the hi-hat high-pass cutoff, which rises from 5kHz to 8kHz as HatTightness goes from 0 to 1
+func (cfg *Settings) hatHighPassCutoff() float64 {
+	return 5000.0 + 3000.0*clampUnit(cfg.HatTightness)
+}
+
+// applyHatTightness applies an exponential decay on top of the ADSR envelope, where the half-life
+// goes from 250ms (loose) to 10ms (very tight) as HatTightness goes from 0 to 1.
+// A HatTightness of 0 leaves the samples untouched.
+func (cfg *Settings) applyHatTightness(samples []float64) []float64 {
+	tightness := clampUnit(cfg.HatTightness)
+	if tightness == 0 {
+		return samples
+	}
+	halfLife := 0.25 * math.Pow(0.01/0.25, tightness)
+	k := math.Ln2 / (halfLife * float64(cfg.SampleRate))
+	tightened := make([]float64, len(samples))
+	for i, sample := range samples {
+		tightened[i] = sample * math.Exp(-k*float64(i))
+	}
+	return tightened
+}
+
+// clampUnit clamps the given value to the [0, 1] range
+func clampUnit(x float64) float64 {
+	if x < 0 {
+		return 0
+	} else if x > 1 {
+		return 1
+	}
+	return x
+}
+
 // GenerateRimshot generates a rimshot sound by using a short burst of high-frequency noise
 func (cfg *Settings) GenerateRimshot() ([]float64, error) {
 	numSamples := int(float64(cfg.SampleRate) * cfg.Duration)
 
 	// Generate a sharp, metallic noise burst for the rimshot
-	noiseSamples := GenerateWhiteNoise(numSamples, cfg.NoiseAmount)
+	noiseSamples := whiteNoise(cfg.noiseSource(), numSamples, cfg.NoiseAmount)
 
 	// Apply a band-pass filter to focus the rimshot on high-mid frequencies
 	noiseSamples = BandPassFilter(noiseSamples, 2000.0, 6000.0, cfg.SampleRate)
 
 	// Apply a short ADSR envelope to make it a quick, percussive sound
-	samples := ApplyEnvelope(noiseSamples, cfg.Attack, cfg.Decay, cfg.Sustain, cfg.Release, cfg.SampleRate)
+	samples := cfg.applyEnvelope(noiseSamples)
 
 	// Add drive (distortion) for punch
-	samples = Drive(samples, cfg.Drive)
+	samples = cfg.drive(samples)
 
 	// Apply limiter to prevent clipping
-	samples = Limiter(samples)
+	samples = cfg.postProcess(samples)
 
 	return samples, nil
 }
 
-// GenerateTom generates a tom drum sound, configurable for low, mid, and high toms
+// hitSeedPrime is used for deriving a separate seed for each hit from the Seed
+const hitSeedPrime = 1000000007
+
+// pitchRandomRatio returns a frequency ratio for a random pitch offset within ±PitchRandomCents for the given
+// hit, to avoid machine-gun repetition. If UseSeed is set, the offset is drawn from a source that is seeded with
+// both the Seed and the hit, so that the same hit always gets the same offset. Otherwise, it is drawn from
+// randomSource.
+func (cfg *Settings) pitchRandomRatio(hit int) float64 {
+	if cfg.PitchRandomCents <= 0 {
+		return 1
+	}
+	r := cfg.randomSource()
+	if cfg.UseSeed {
+		r = rand.New(rand.NewSource(cfg.Seed ^ int64(hit)*hitSeedPrime))
+	}
+	cents := (2*r.Float64() - 1) * cfg.PitchRandomCents
+	return math.Pow(2, cents/1200)
+}
+
+// nextHit returns the number of the next tom or percussion hit, counting from 0, and advances the count.
+// The count is safe for concurrent use, and a copy of the settings continues counting on its own.
+func (cfg *Settings) nextHit() int {
+	return int(atomic.AddInt64(&cfg.hits, 1) - 1)
+}
+
+// GenerateTom generates a tom drum sound, configurable for low, mid, and high toms.
+// Each call generates the next hit, with a new random pitch offset within ±PitchRandomCents.
 func (cfg *Settings) GenerateTom() ([]float64, error) {
+	return cfg.GenerateTomHit(cfg.nextHit())
+}
+
+// GenerateTomHit generates the given hit (counting from 0) of a series of tom hits, where each hit has its own
+// random pitch offset within ±PitchRandomCents
+func (cfg *Settings) GenerateTomHit(hit int) ([]float64, error) {
 	numSamples := int(float64(cfg.SampleRate) * cfg.Duration)
 	samples := make([]float64, numSamples)
 
 	// Generate a decaying sine wave to represent the tom's body
+	frequencies := cfg.frequencyTrajectory(numSamples)
+	ratio := cfg.pitchRandomRatio(hit)
 	for i := 0; i < numSamples; i++ {
 		t := float64(i) / float64(cfg.SampleRate)
-		frequency := cfg.StartFreq * math.Pow(cfg.EndFreq/cfg.StartFreq, t/cfg.Duration)
-		sample := math.Sin(2 * math.Pi * frequency * t)
-		samples[i] = sample
+		frequency := frequencies[i] * ratio
+		sample := cfg.sin(2 * math.Pi * frequency * t)
+		samples[i] = cfg.retroSample(sample)
 	}
 
 	// Apply ADSR envelope to shape the sound of the tom
-	samples = ApplyEnvelope(samples, cfg.Attack, cfg.Decay, cfg.Sustain, cfg.Release, cfg.SampleRate)
+	samples = cfg.applyEnvelope(samples)
 
 	// Add a bit of pink noise to simulate drum head vibrations
-	noiseSamples := GeneratePinkNoise(numSamples, cfg.NoiseAmount)
+	noiseSamples := pinkNoise(cfg.noiseSource(), numSamples, cfg.NoiseAmount)
 	noiseSamples = LowPassFilter(noiseSamples, cfg.FilterCutoff, cfg.SampleRate)
 	for i := 0; i < numSamples; i++ {
 		samples[i] += noiseSamples[i] * 0.2 // Slight noise mixed in
 	}
 
 	// Apply drive (distortion) to give the tom more depth
-	samples = Drive(samples, cfg.Drive)
+	samples = cfg.drive(samples)
 
 	// Apply limiter to keep the sound within [-1, 1] range
-	samples = Limiter(samples)
+	samples = cfg.postProcess(samples)
 
 	return samples, nil
 }
 
-// GeneratePercussion generates a tonal percussion sound like bongo or conga
+// GeneratePercussion generates a tonal percussion sound like bongo or conga.
+// Each call generates the next hit, with a new random pitch offset within ±PitchRandomCents.
 func (cfg *Settings) GeneratePercussion() ([]float64, error) {
+	return cfg.GeneratePercussionHit(cfg.nextHit())
+}
+
+// GeneratePercussionHit generates the given hit (counting from 0) of a series of percussion hits, where each
+// hit has its own random pitch offset within ±PitchRandomCents
+func (cfg *Settings) GeneratePercussionHit(hit int) ([]float64, error) {
 	numSamples := int(float64(cfg.SampleRate) * cfg.Duration)
 	samples := make([]float64, numSamples)
 
 	// Generate the tonal part using a high-pitched sine or triangle wave
+	ratio := cfg.pitchRandomRatio(hit)
 	for i := 0; i < numSamples; i++ {
 		t := float64(i) / float64(cfg.SampleRate)
-		frequency := cfg.StartFreq * math.Pow(cfg.EndFreq/cfg.StartFreq, t/cfg.Duration)
-		sample := math.Sin(2 * math.Pi * frequency * t)
-		samples[i] = sample
+		frequency := cfg.sweepFrequency(t) * ratio
+		sample := cfg.sin(2 * math.Pi * frequency * t)
+		samples[i] = cfg.retroSample(sample)
 	}
 
 	// Apply a quick, snappy ADSR envelope for the short percussion hit
-	samples = ApplyEnvelope(samples, cfg.Attack, cfg.Decay, cfg.Sustain, cfg.Release, cfg.SampleRate)
+	samples = cfg.applyEnvelope(samples)
 
 	// Add a small amount of pink noise for texture
-	noiseSamples := GeneratePinkNoise(numSamples, cfg.NoiseAmount)
+	noiseSamples := pinkNoise(cfg.noiseSource(), numSamples, cfg.NoiseAmount)
 	noiseSamples = BandPassFilter(noiseSamples, 300.0, 1000.0, cfg.SampleRate)
 
 	for i := 0; i < numSamples; i++ {
@@ -239,10 +352,10 @@ func (cfg *Settings) GeneratePercussion() ([]float64, error) {
 	}
 
 	// Apply drive to enhance the percussive attack
-	samples = Drive(samples, cfg.Drive)
+	samples = cfg.drive(samples)
 
 	// Apply limiter to keep the sound within [-1, 1] range
-	samples = Limiter(samples)
+	samples = cfg.postProcess(samples)
 
 	return samples, nil
 }
@@ -252,19 +365,22 @@ func (cfg *Settings) GenerateRide() ([]float64, error) {
 	numSamples := int(float64(cfg.SampleRate) * cfg.Duration)
 
 	// Generate metallic noise for the ride cymbal
-	noiseSamples := GenerateWhiteNoise(numSamples, cfg.NoiseAmount)
+	noiseSamples := whiteNoise(cfg.noiseSource(), numSamples, cfg.NoiseAmount)
 
 	// Apply a high-pass filter to keep the ride focused on high frequencies
 	noiseSamples = HighPassFilter(noiseSamples, 5000.0, cfg.SampleRate)
 
 	// Apply a longer ADSR envelope to simulate the ringing sound of a ride cymbal
-	samples := ApplyEnvelope(noiseSamples, cfg.Attack, cfg.Decay, cfg.Sustain, cfg.Release, cfg.SampleRate)
+	samples := cfg.applyEnvelope(noiseSamples)
 
 	// Apply drive (distortion) for added metallic resonance
-	samples = Drive(samples, cfg.Drive)
+	samples = cfg.drive(samples)
+
+	// Let the ride ring out with a reverb tail
+	samples = cfg.appendCymbalTail(samples)
 
 	// Apply limiter to ensure the output stays in the [-1, 1] range
-	samples = Limiter(samples)
+	samples = cfg.postProcess(samples)
 
 	return samples, nil
 }
@@ -274,103 +390,617 @@ func (cfg *Settings) GenerateCrash() ([]float64, error) {
 	numSamples := int(float64(cfg.SampleRate) * cfg.Duration)
 
 	// Generate wide-spectrum noise for the crash cymbal
-	noiseSamples := GenerateWhiteNoise(numSamples, cfg.NoiseAmount)
+	noiseSamples := whiteNoise(cfg.noiseSource(), numSamples, cfg.NoiseAmount)
 
 	// Apply a band-pass filter to focus on the metallic frequency range
 	noiseSamples = BandPassFilter(noiseSamples, 2000.0, 15000.0, cfg.SampleRate)
 
 	// Apply a quick attack and a longer decay ADSR envelope
-	samples := ApplyEnvelope(noiseSamples, cfg.Attack, cfg.Decay, cfg.Sustain, cfg.Release, cfg.SampleRate)
+	samples := cfg.applyEnvelope(noiseSamples)
 
 	// Add drive to enhance the "explosive" nature of the crash
-	samples = Drive(samples, cfg.Drive)
+	samples = cfg.drive(samples)
+
+	// Let the crash wash out with a reverb tail
+	samples = cfg.appendCymbalTail(samples)
 
 	// Apply limiter to keep the sound within the [-1, 1] range
-	samples = Limiter(samples)
+	samples = cfg.postProcess(samples)
 
 	return samples, nil
 }
 
+// appendCymbalTail appends a reverb tail that is CymbalReverbTail seconds long to the samples, if it is set
+func (cfg *Settings) appendCymbalTail(samples []float64) []float64 {
+	if cfg.CymbalReverbTail <= 0 {
+		return samples
+	}
+	return AppendReverbTail(samples, cfg.CymbalReverbTail, cfg.SampleRate)
+}
+
+// defaultFrequencySmoothing is the time constant, in seconds, that is used when SmoothFrequencyTransitions
+// is enabled but FrequencySmoothing is not set
+const defaultFrequencySmoothing = 0.002
+
+// validateSweep checks that the sweep from StartFreq to EndFreq is well defined, since the exponential sweep
+// needs frequencies above zero
+func (cfg *Settings) validateSweep() error {
+	if cfg.StartFreq <= 0 || cfg.EndFreq <= 0 {
+		return fmt.Errorf("the start and end frequencies must be above zero, got %g Hz and %g Hz", cfg.StartFreq, cfg.EndFreq)
+	}
+	return nil
+}
+
+// sweepFrequency returns the frequency of the exponential sweep from StartFreq to EndFreq at time t.
+// If the start and end frequencies are equal, the result is a steady tone.
+func (cfg *Settings) sweepFrequency(t float64) float64 {
+	if cfg.StartFreq == cfg.EndFreq || cfg.Duration <= 0 {
+		return cfg.StartFreq
+	}
+	return cfg.StartFreq * math.Pow(cfg.EndFreq/cfg.StartFreq, t/cfg.Duration)
+}
+
+// frequencyTrajectory returns the frequency for each sample of the sweep from StartFreq to EndFreq.
+// If SmoothFrequencyTransitions is enabled, the trajectory is smoothed with a one-pole filter,
+// using FrequencySmoothing as the time constant, unless RetroMode is enabled.
+func (cfg *Settings) frequencyTrajectory(numSamples int) []float64 {
+	frequencies := make([]float64, numSamples)
+	for i := range frequencies {
+		t := float64(i) / float64(cfg.SampleRate)
+		frequencies[i] = cfg.sweepFrequency(t)
+	}
+	if !cfg.SmoothFrequencyTransitions || cfg.RetroMode || numSamples == 0 {
+		return frequencies
+	}
+	timeConstant := cfg.FrequencySmoothing
+	if timeConstant <= 0 {
+		timeConstant = defaultFrequencySmoothing
+	}
+	alpha := 1 - math.Exp(-1.0/(timeConstant*float64(cfg.SampleRate)))
+	smoothed := frequencies[0]
+	for i, frequency := range frequencies {
+		smoothed += alpha * (frequency - smoothed)
+		frequencies[i] = smoothed
+	}
+	return frequencies
+}
+
+// thumpQ is the Q of the resonant peaking EQ that is used for boosting the kick body when ThumpGainDB is set
+const thumpQ = 1.4
+
+// kickOscillatorDetune is the detuning between each of the layered kick oscillators, as a fraction of the frequency
+const kickOscillatorDetune = 0.003
+
+// goldenRatioConjugate is used for spreading the start phases of free running oscillators
+const goldenRatioConjugate = 0.6180339887498949
+
+// oscillatorWaveform returns the waveform of oscillator n, which is the WaveformType unless
+// OscillatorWaveforms has a waveform for that oscillator
+func (cfg *Settings) oscillatorWaveform(n int) int {
+	if n < len(cfg.OscillatorWaveforms) {
+		return cfg.OscillatorWaveforms[n]
+	}
+	return cfg.WaveformType
+}
+
+// tonalOscillators returns true if the first numOscillators oscillators all have tonal (not noise) waveforms
+func (cfg *Settings) tonalOscillators(numOscillators int) bool {
+	for n := 0; n < numOscillators; n++ {
+		if waveform := cfg.oscillatorWaveform(n); waveform < WaveSine || waveform > WaveSquare {
+			return false
+		}
+	}
+	return true
+}
+
+// oscillatorValue returns the value of the given tonal waveform at the given phase, in cycles.
+// If RetroMode is enabled, the value is quantized to retroBitDepth bits.
+func (cfg *Settings) oscillatorValue(waveform int, phase float64) float64 {
+	var value float64
+	switch waveform {
+	case WaveTriangle:
+		value = 2*math.Abs(2*(phase-math.Floor(phase+0.5))) - 1
+	case WaveSawtooth:
+		value = 2 * (phase - math.Floor(0.5+phase))
+	case WaveSquare:
+		value = math.Copysign(1.0, cfg.sin(2*math.Pi*phase))
+	default:
+		value = cfg.sin(2 * math.Pi * phase)
+	}
+	return cfg.retroSample(value)
+}
+
+// oscillatorPhases returns the start phases of the layered oscillators, which are spread out unless the
+// oscillators are synced or AlignTransients is enabled, where all of the layers start together at sample 0
+func (cfg *Settings) oscillatorPhases(numOscillators int) []float64 {
+	phases := make([]float64, numOscillators)
+	if !cfg.SyncOscillators && !cfg.AlignTransients {
+		for n := range phases {
+			phases[n] = math.Mod(float64(n)*goldenRatioConjugate, 1)
+		}
+	}
+	return phases
+}
+
+// oscillatorLayers returns the mix of the layered oscillators at the current phases, using the OscillatorLevels
+// and OscillatorWaveforms, and then advances the phases. If gains is not nil, each oscillator is also scaled by
+// its gain. If SyncOscillators is enabled, the other oscillators are hard synced to the first (lowest)
+// oscillator, so that they restart each time it starts a new cycle.
+func (cfg *Settings) oscillatorLayers(phases []float64, frequency float64, gains []float64) float64 {
+	sum := 0.0
+	for n, phase := range phases {
+		level := 1.0
+		if n < len(cfg.OscillatorLevels) {
+			level = cfg.OscillatorLevels[n]
+		}
+		if gains != nil {
+			level *= gains[n]
+		}
+		sum += level * cfg.oscillatorValue(cfg.oscillatorWaveform(n), phase)
+	}
+	newCycle := false
+	for n := range phases {
+		phases[n] += frequency * (1 + float64(n)*kickOscillatorDetune) / float64(cfg.SampleRate)
+		if phases[n] >= 1 {
+			phases[n] -= math.Floor(phases[n])
+			newCycle = newCycle || n == 0
+		}
+	}
+	if cfg.SyncOscillators && newCycle {
+		for n := 1; n < len(phases); n++ {
+			phases[n] = phases[0] * (1 + float64(n)*kickOscillatorDetune)
+		}
+	}
+	return sum / float64(len(phases))
+}
+
+// kickEnvelopeAtTime returns the amplitude envelope of the kick at time t. If DecayStage2Sec is set, this is a
+// two-stage decay, like on an 808: after the attack, the level drops exponentially to DecayStage2Level over
+// Decay seconds, and then it falls slowly, by a factor of e for every DecayStage2Sec seconds.
+// Otherwise, it is the regular envelope.
+func (cfg *Settings) kickEnvelopeAtTime(t float64) float64 {
+	if cfg.DecayStage2Sec <= 0 {
+		return cfg.ApplyEnvelopeAtTime(t)
+	}
+	if t < cfg.Attack {
+		return t / cfg.Attack
+	}
+	shoulder := math.Max(cfg.DecayStage2Level, 1e-6)
+	if t -= cfg.Attack; t < cfg.Decay {
+		return math.Pow(shoulder, t/cfg.Decay)
+	}
+	return shoulder * math.Exp(-(t-cfg.Decay)/cfg.DecayStage2Sec)
+}
+
+// Click layer settings for the kick, where the click is a short burst that decays exponentially
+const (
+	clickLevel     = 0.5
+	clickDuration  = 0.005  // in seconds
+	clickDecay     = 0.001  // time constant, in seconds
+	clickFrequency = 3000.0 // for the square and sine clicks, in Hz
+)
+
+// kickClick returns the click layer for the attack of the kick, as numSamples samples, with the
+// character given by ClickSource: high-passed noise for an acoustic beater, a square wave for a synthetic
+// snap, or a sine wave for a softer tick
+func (cfg *Settings) kickClick(numSamples int) []float64 {
+	click := make([]float64, min(int(clickDuration*float64(cfg.SampleRate)), numSamples))
+	var source []float64
+	switch cfg.ClickSource {
+	case ClickNoise:
+		source = HighPassFilter(whiteNoise(cfg.noiseSource(), len(click), 1.0), 2000, cfg.SampleRate)
+	case ClickSquare, ClickSine:
+		source = make([]float64, len(click))
+		for i := range source {
+			phase := clickFrequency * float64(i) / float64(cfg.SampleRate)
+			if cfg.ClickSource == ClickSquare {
+				source[i] = cfg.oscillatorValue(WaveSquare, phase)
+			} else {
+				source[i] = cfg.oscillatorValue(WaveSine, phase)
+			}
+		}
+	default:
+		return click
+	}
+	for i := range click {
+		click[i] = clickLevel * source[i] * math.Exp(-float64(i)/(clickDecay*float64(cfg.SampleRate)))
+	}
+	return click
+}
+
 // GenerateKick generates the kick waveform and returns it as a slice of float64 samples (without writing to disk).
 func (cfg *Settings) GenerateKick() ([]float64, error) {
+	return cfg.generateKick(nil)
+}
+
+// GenerateKickStereo generates the kick as a left and a right channel, where each of the layered oscillators
+// is panned with OscillatorPans, from -1 (left) to 1 (right), using a constant power pan law. Oscillators
+// without a pan are centered. If the oscillators are not layered, both channels are the same.
+func (cfg *Settings) GenerateKickStereo() (left, right []float64, err error) {
+	if cfg.NumOscillators <= 1 || !cfg.tonalOscillators(cfg.NumOscillators) {
+		mono, err := cfg.GenerateKick()
+		if err != nil {
+			return nil, nil, err
+		}
+		return mono, append([]float64(nil), mono...), nil
+	}
+	leftGains := make([]float64, cfg.NumOscillators)
+	rightGains := make([]float64, cfg.NumOscillators)
+	for n := range leftGains {
+		pan := 0.0
+		if n < len(cfg.OscillatorPans) {
+			pan = math.Max(-1, math.Min(1, cfg.OscillatorPans[n]))
+		}
+		leftGains[n] = math.Cos((pan + 1) * math.Pi / 4)
+		rightGains[n] = math.Cos((1 - pan) * math.Pi / 4)
+	}
+	if left, err = cfg.generateKick(leftGains); err != nil {
+		return nil, nil, err
+	}
+	if right, err = cfg.generateKick(rightGains); err != nil {
+		return nil, nil, err
+	}
+	return left, right, nil
+}
+
+// generateKick generates the kick, where the layered oscillators are scaled by the given gains, if not nil
+func (cfg *Settings) generateKick(gains []float64) ([]float64, error) {
+	samples, err := cfg.generateKickBody(gains)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.postProcess(samples), nil
+}
+
+// generateKickBody generates the kick before the final processing of postProcess, where the layered oscillators
+// are scaled by the given gains, if not nil
+func (cfg *Settings) generateKickBody(gains []float64) ([]float64, error) {
+	if err := cfg.validateSweep(); err != nil {
+		return nil, err
+	}
 	numSamples := int(float64(cfg.SampleRate) * cfg.Duration)
 	samples := make([]float64, numSamples)
+	frequencies := cfg.frequencyTrajectory(numSamples)
+
+	// With more than one tonal oscillator, the oscillators are layered and slightly detuned.
+	// Unless they are synced or the transients are aligned, they are free running and start at different phases.
+	layered := cfg.NumOscillators > 1 && cfg.tonalOscillators(cfg.NumOscillators)
+	var phases []float64
+	if layered {
+		phases = cfg.oscillatorPhases(cfg.NumOscillators)
+	}
+	r := cfg.noiseSource()
 
 	for i := 0; i < numSamples; i++ {
 		t := float64(i) / float64(cfg.SampleRate)
-		frequency := cfg.StartFreq * math.Pow(cfg.EndFreq/cfg.StartFreq, t/cfg.Duration)
+		frequency := frequencies[i]
 		var sample float64
 
-		switch cfg.WaveformType {
-		case WaveSine:
-			sample = math.Sin(2 * math.Pi * frequency * t)
-		case WaveTriangle:
-			sample = 2*math.Abs(2*(t*frequency-math.Floor(t*frequency+0.5))) - 1
-		case WaveSawtooth:
-			sample = 2 * (t*frequency - math.Floor(0.5+t*frequency))
-		case WaveSquare:
-			sample = math.Copysign(1.0, math.Sin(2*math.Pi*frequency*t))
-		case WaveWhiteNoise:
-			sample = GenerateWhiteNoise(1, cfg.NoiseAmount)[0]
-		case WavePinkNoise:
-			sample = GeneratePinkNoise(1, cfg.NoiseAmount)[0]
-		case WaveBrownNoise:
-			sample = GenerateBrownNoise(1, cfg.NoiseAmount)[0]
-		default:
-			return nil, fmt.Errorf("unsupported waveform type: %d", cfg.WaveformType)
+		if layered {
+			sample = cfg.oscillatorLayers(phases, frequency, gains)
+		} else {
+			switch cfg.WaveformType {
+			case WaveSine:
+				sample = cfg.sin(2 * math.Pi * frequency * t)
+			case WaveTriangle:
+				sample = 2*math.Abs(2*(t*frequency-math.Floor(t*frequency+0.5))) - 1
+			case WaveSawtooth:
+				sample = 2 * (t*frequency - math.Floor(0.5+t*frequency))
+			case WaveSquare:
+				sample = math.Copysign(1.0, cfg.sin(2*math.Pi*frequency*t))
+			case WaveWhiteNoise:
+				sample = whiteNoise(r, 1, cfg.NoiseAmount)[0]
+			case WavePinkNoise:
+				sample = pinkNoise(r, 1, cfg.NoiseAmount)[0]
+			case WaveBrownNoise:
+				sample = brownNoise(r, 1, cfg.NoiseAmount)[0]
+			default:
+				return nil, fmt.Errorf("unsupported waveform type: %d", cfg.WaveformType)
+			}
 		}
+		sample = cfg.retroSample(sample)
 
-		if len(cfg.OscillatorLevels) > 0 {
+		if !layered && len(cfg.OscillatorLevels) > 0 {
 			sample *= cfg.OscillatorLevels[0]
 		}
 
-		sample *= cfg.ApplyEnvelopeAtTime(t)
+		sample *= cfg.kickEnvelopeAtTime(t)
 		sample = cfg.ApplyDrive(sample)
-		samples[i] = sample
+		samples[i] = cfg.retroSample(sample)
+	}
+
+	// Layer a short click on top of the attack
+	if cfg.ClickSource != ClickNone {
+		click := cfg.kickClick(numSamples)
+		if cfg.AlignTransients {
+			click = alignPolarity(samples, click)
+		}
+		for i, sample := range click {
+			samples[i] += sample
+		}
+	}
+
+	// Boost the "thump" band, and let the limiter saturate the boosted signal
+	if cfg.ThumpFreq > 0 && cfg.ThumpGainDB != 0 {
+		samples = PeakingEQ(samples, cfg.ThumpFreq, thumpQ, cfg.ThumpGainDB, cfg.SampleRate)
+	}
+
+	return samples, nil
+}
+
+// alignPolarity returns the layer, inverted if it would otherwise work against the start of the reference,
+// so that the two reinforce each other when they are mixed
+func alignPolarity(reference, layer []float64) []float64 {
+	dot := 0.0
+	for i := 0; i < len(layer) && i < len(reference); i++ {
+		dot += reference[i] * layer[i]
+	}
+	if dot >= 0 {
+		return layer
+	}
+	inverted := make([]float64, len(layer))
+	for i, sample := range layer {
+		inverted[i] = -sample
+	}
+	return inverted
+}
+
+// maxTransientAlignment is how far, in seconds, a transient may be moved to line up with the attack of the kick,
+// when AlignTransients is enabled
+const maxTransientAlignment = 0.005
+
+// maxTransientDuration is the longest part of a transient WAV file, in seconds, that is layered on top of a kick
+const maxTransientDuration = 0.05
+
+// GenerateKickWithTransient generates a kick and layers a recorded transient (like a beater click) from the
+// given WAV file on top of the attack. The transient is downmixed to mono, resampled to the sample rate of the kick,
+// trimmed to at most 50 ms, and faded out with the second half of a Hann window. If AlignTransients is enabled,
+// the transient is first lined up with the attack of the kick by cross-correlation, so that it reinforces
+// the attack instead of smearing it. The transient is mixed in before the final processing, so that the
+// layered kick gets the same limiter, fade-out, trimming, gain and quantization as a regular kick.
+func (cfg *Settings) GenerateKickWithTransient(transientPath string) ([]float64, error) {
+	samples, err := cfg.generateKickBody(nil)
+	if err != nil {
+		return nil, err
+	}
+	transient, sampleRate, err := loadWavMono(transientPath)
+	if err != nil {
+		return nil, fmt.Errorf("error loading transient: %v", err)
+	}
+	transient = ResampleSinc(transient, sampleRate, cfg.SampleRate, 16)
+	if cfg.AlignTransients {
+		_, transient = AlignByCorrelation(samples, transient, int(maxTransientAlignment*float64(cfg.SampleRate)))
+	}
+	transientSamples := min(len(transient), int(maxTransientDuration*float64(cfg.SampleRate)))
+	fade := Window(2*transientSamples, WindowHann)[transientSamples:]
+	for i := 0; i < transientSamples && i < len(samples); i++ {
+		samples[i] += transient[i] * fade[i]
+	}
+	return cfg.postProcess(samples), nil
+}
+
+// membraneModes are the frequency ratios of the lowest modes of an ideal circular membrane, relative to the fundamental
+var membraneModes = []float64{1.0, 1.594, 2.136, 2.296, 2.653, 2.918}
+
+// GeneratePhysicalKick generates a kick drum by modeling a membrane instead of sweeping an oscillator.
+// A short mallet excitation is sent through a bank of resonators that are tuned to the modes of a circular
+// membrane, with EndFreq as the fundamental. The fundamental rings for the whole Duration, while the
+// higher modes die out faster.
+func (cfg *Settings) GeneratePhysicalKick() ([]float64, error) {
+	if cfg.EndFreq <= 0 {
+		return nil, fmt.Errorf("invalid fundamental frequency: %f", cfg.EndFreq)
+	}
+	numSamples := int(float64(cfg.SampleRate) * cfg.Duration)
+	samples := make([]float64, numSamples)
+
+	// The excitation is a raised cosine pulse from the mallet, with a bit of noise for the beater click
+	malletSamples := int(0.002 * float64(cfg.SampleRate))
+	excitation := make([]float64, numSamples)
+	noiseSamples := whiteNoise(cfg.noiseSource(), numSamples, cfg.NoiseAmount)
+	for i := 0; i < malletSamples && i < numSamples; i++ {
+		pulse := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(malletSamples))
+		excitation[i] = pulse + noiseSamples[i]*0.2
+	}
+
+	// Let each mode of the membrane resonate, where higher modes are quieter and decay faster
+	for n, ratio := range membraneModes {
+		var resonator biquad
+		resonator.setResonator(cfg.EndFreq*ratio, cfg.Duration/ratio, cfg.SampleRate)
+		gain := 1.0 / float64(n+1)
+		for i, x := range excitation {
+			samples[i] += resonator.process(x) * gain
+		}
+	}
+
+	// Normalize the resonator bank output before applying the level and drive
+	peak := 0.0
+	for _, sample := range samples {
+		peak = math.Max(peak, math.Abs(sample))
+	}
+	level := 1.0
+	if len(cfg.OscillatorLevels) > 0 {
+		level = cfg.OscillatorLevels[0]
+	}
+	for i, sample := range samples {
+		if peak > 0 {
+			sample /= peak
+		}
+		samples[i] = cfg.ApplyDrive(sample * level)
+	}
+
+	samples = cfg.postProcess(samples)
+	return samples, nil
+}
+
+// GenerateMorph generates a sound that morphs from a pitched oscillator into filtered noise over the duration,
+// for glitchy and experimental textures. startTonal is the level of the oscillator at the start and endNoise
+// is the level of the noise at the end, both in the [0, 1] range, and the two are crossfaded linearly.
+func (cfg *Settings) GenerateMorph(startTonal, endNoise float64) ([]float64, error) {
+	if startTonal < 0 || startTonal > 1 || endNoise < 0 || endNoise > 1 {
+		return nil, fmt.Errorf("startTonal and endNoise must be between 0 and 1, got %f and %f", startTonal, endNoise)
+	}
+	numSamples := int(float64(cfg.SampleRate) * cfg.Duration)
+	samples := make([]float64, numSamples)
+	frequencies := cfg.frequencyTrajectory(numSamples)
+	noiseSamples := LowPassFilter(whiteNoise(cfg.noiseSource(), numSamples, cfg.NoiseAmount), cfg.FilterCutoff, cfg.SampleRate)
+
+	phase := 0.0
+	for i := 0; i < numSamples; i++ {
+		t := float64(i) / float64(cfg.SampleRate)
+		progress := float64(i) / float64(max(numSamples-1, 1))
+		tonalLevel := startTonal + (1-endNoise-startTonal)*progress
+		noiseLevel := (1 - startTonal) + (endNoise-(1-startTonal))*progress
+		sample := cfg.sin(2*math.Pi*phase)*tonalLevel + noiseSamples[i]*noiseLevel
+		phase += frequencies[i] / float64(cfg.SampleRate)
+		sample *= cfg.ApplyEnvelopeAtTime(t)
+		samples[i] = cfg.ApplyDrive(sample)
 	}
 
-	samples = Limiter(samples)
+	samples = cfg.postProcess(samples)
 	return samples, nil
 }
 
 // GenerateSweepWaveform generates a frequency sweep waveform based on the settings.
 func (cfg *Settings) GenerateSweepWaveform() ([]float64, error) {
+	if err := cfg.validateSweep(); err != nil {
+		return nil, err
+	}
 	numSamples := int(cfg.Duration * float64(cfg.SampleRate))
 	samples := make([]float64, numSamples)
+	r := cfg.noiseSource()
 
 	for i := 0; i < numSamples; i++ {
 		t := float64(i) / float64(cfg.SampleRate)
 		// Calculate the frequency at time t
-		frequency := cfg.StartFreq * math.Pow(cfg.EndFreq/cfg.StartFreq, t/cfg.Duration)
+		frequency := cfg.sweepFrequency(t)
 		var sample float64
 
 		switch cfg.WaveformType {
 		case WaveSine:
-			sample = math.Sin(2 * math.Pi * frequency * t)
+			sample = cfg.sin(2 * math.Pi * frequency * t)
 		case WaveTriangle:
 			sample = 2*math.Abs(2*(t*frequency-math.Floor(t*frequency+0.5))) - 1
 		case WaveSawtooth:
 			sample = 2 * (t*frequency - math.Floor(0.5+t*frequency))
 		case WaveSquare:
-			sample = math.Copysign(1.0, math.Sin(2*math.Pi*frequency*t))
+			sample = math.Copysign(1.0, cfg.sin(2*math.Pi*frequency*t))
 		case WaveWhiteNoise:
-			sample = GenerateWhiteNoise(1, cfg.NoiseAmount)[0]
+			sample = whiteNoise(r, 1, cfg.NoiseAmount)[0]
 		case WavePinkNoise:
-			sample = GeneratePinkNoise(1, cfg.NoiseAmount)[0]
+			sample = pinkNoise(r, 1, cfg.NoiseAmount)[0]
 		case WaveBrownNoise:
-			sample = GenerateBrownNoise(1, cfg.NoiseAmount)[0]
+			sample = brownNoise(r, 1, cfg.NoiseAmount)[0]
 		default:
 			return nil, fmt.Errorf("unsupported waveform type: %d", cfg.WaveformType)
 		}
 
-		samples[i] = sample
+		samples[i] = cfg.retroSample(sample)
 	}
 
 	return samples, nil
 }
 
-// Generate is a wrapper function that calls the appropriate Generate* function based on the given sound type
+// softStartDuration is the length, in seconds, of the micro fade-in that is applied when SoftStart is enabled
+const softStartDuration = 0.0015
+
+// softStart fades in the first 1.5 ms of the samples with a raised cosine curve that starts at exactly 0,
+// which removes the click from sounds that start at a non-zero level, regardless of the attack
+func softStart(samples []float64, sampleRate int) []float64 {
+	faded := make([]float64, len(samples))
+	copy(faded, samples)
+	fadeSamples := min(int(softStartDuration*float64(sampleRate)), len(faded))
+	for i := 0; i < fadeSamples; i++ {
+		faded[i] *= 0.5 - 0.5*math.Cos(math.Pi*float64(i)/float64(fadeSamples))
+	}
+	return faded
+}
+
+// AutoTrimThreshold is the level (about -60 dBFS) below which trailing samples are trimmed when AutoTrim is enabled
+const AutoTrimThreshold = 0.001
+
+// postProcess applies the final processing that is shared by all generators: trimming StartOffset seconds from
+// the start, a micro fade-in if SoftStart is enabled (and RetroMode is not), the limiter (unless NoLimiter is set), a clean fade-out over FadeDuration seconds, trimming
+// of the trailing silence if AutoTrim is enabled, the OutputGain, and 8-bit quantization if RetroMode is enabled.
+// An OutputGain of 0 is treated as unity gain, like 1. Unless NoLimiter is set, the samples are limited again
+// after the OutputGain, so that they stay within [-1, 1].
+func (cfg *Settings) postProcess(samples []float64) []float64 {
+	if cfg.StartOffset > 0 {
+		samples = samples[min(int(cfg.StartOffset*float64(cfg.SampleRate)), len(samples)):]
+	}
+	if cfg.SoftStart && !cfg.RetroMode {
+		samples = softStart(samples, cfg.SampleRate)
+	}
+	if !cfg.NoLimiter {
+		samples = Limiter(samples)
+	}
+	if cfg.FadeDuration > 0 {
+		samples = CleanTail(samples, cfg.FadeDuration, cfg.SampleRate)
+	}
+	if cfg.AutoTrim {
+		samples = TrimTrailingSilence(samples, AutoTrimThreshold)
+	}
+	if cfg.OutputGain > 0 && cfg.OutputGain != 1 {
+		samples = ApplyGainDB(samples, LinearToDB(cfg.OutputGain))
+		if !cfg.NoLimiter {
+			// A gain above 1 can push the limited signal past full scale again
+			samples = Limiter(samples)
+		}
+	}
+	if cfg.RetroMode {
+		samples = retroQuantize(samples)
+	}
+	return samples
+}
+
+// retroBitDepth is the bit depth that the samples are quantized to when RetroMode is enabled. In RetroMode, the
+// naive oscillators are quantized sample by sample while they are generated, the frequency sweeps are not smoothed,
+// no soft start is applied, and the final samples are quantized once more after the gain.
+const retroBitDepth = 8
+
+// retroQuantize quantizes the samples to retroBitDepth bits without any dithering, which gives the
+// characteristic stepped waveform and grainy sound of 8-bit consoles
+func retroQuantize(samples []float64) []float64 {
+	quantized := make([]float64, len(samples))
+	for i, sample := range samples {
+		quantized[i] = retroQuantizeSample(sample)
+	}
+	return quantized
+}
+
+// retroQuantizeSample quantizes a single sample to retroBitDepth bits, without any dithering
+func retroQuantizeSample(sample float64) float64 {
+	maxIntValue := float64(int(1)<<(retroBitDepth-1)) - 1
+	return math.Round(math.Max(-1, math.Min(1, sample))*maxIntValue) / maxIntValue
+}
+
+// retroSample returns the sample quantized to retroBitDepth bits if RetroMode is enabled, or unchanged if not.
+// It is used inside the oscillator loops, so that the naive oscillators are stepped already during generation.
+func (cfg *Settings) retroSample(sample float64) float64 {
+	if !cfg.RetroMode {
+		return sample
+	}
+	return retroQuantizeSample(sample)
+}
+
+// TrimTrailingSilence removes the samples at the end that are below the given threshold (in absolute value)
+func TrimTrailingSilence(samples []float64, threshold float64) []float64 {
+	end := len(samples)
+	for end > 0 && math.Abs(samples[end-1]) < threshold {
+		end--
+	}
+	return samples[:end]
+}
+
+// Generate is a wrapper function that calls the appropriate Generate* function based on the given sound type.
+// If IncludeReleaseTail is enabled and the envelope is longer than the duration, the duration is extended
+// so that the release can complete, instead of being squeezed into the duration.
 func (cfg *Settings) Generate() ([]float64, error) {
+	if envelopeDuration := cfg.Attack + cfg.Decay + cfg.Release; cfg.IncludeReleaseTail && envelopeDuration > cfg.Duration {
+		extendedCfg := CopySettings(cfg)
+		extendedCfg.Duration = envelopeDuration
+		extendedCfg.IncludeReleaseTail = false
+		return extendedCfg.Generate()
+	}
 	switch cfg.SoundType {
 	case Kick:
 		return cfg.GenerateKick()
@@ -403,21 +1033,302 @@ func (cfg *Settings) Generate() ([]float64, error) {
 	}
 }
 
+// GenerateFlam generates a flam, which is a quiet grace note followed closely by the main hit, using the
+// configured sound type. The main hit comes flamSpacingSec seconds after the grace note, and graceVelocity
+// (0 to 1) is the level of the grace note compared to the main hit.
+func (cfg *Settings) GenerateFlam(flamSpacingSec, graceVelocity float64) ([]float64, error) {
+	if flamSpacingSec < 0 {
+		return nil, fmt.Errorf("invalid flam spacing: %f", flamSpacingSec)
+	}
+	hit, err := cfg.Generate()
+	if err != nil {
+		return nil, err
+	}
+	offset := int(flamSpacingSec * float64(cfg.SampleRate))
+	samples := make([]float64, len(hit)+offset)
+	for i, sample := range hit {
+		samples[i] += sample * clampUnit(graceVelocity)
+		samples[i+offset] += sample
+	}
+	if !cfg.NoLimiter {
+		samples = Limiter(samples)
+	}
+	return samples, nil
+}
+
+// snareFlamGraceVelocity is the level of the grace note of a snare flam, compared to the main hit
+const snareFlamGraceVelocity = 0.5
+
+// GenerateSnareFlam generates a snare flam, where a quieter grace note comes flamOffsetSec seconds before
+// the main hit, regardless of the configured sound type
+func (cfg *Settings) GenerateSnareFlam(flamOffsetSec float64) ([]float64, error) {
+	snareCfg := CopySettings(cfg)
+	snareCfg.SoundType = Snare
+	return snareCfg.GenerateFlam(flamOffsetSec, snareFlamGraceVelocity)
+}
+
+// RenderAB generates the sound type with the given name, like "kick" or "snare", with two presets, and matches
+// their loudness, so that they can be compared fairly. The louder of the two is turned down to the RMS level of
+// the quieter one.
+func RenderAB(a, b *Settings, t string) (aSamples, bSamples []float64, err error) {
+	if aSamples, err = a.generateSoundType(t); err != nil {
+		return nil, nil, fmt.Errorf("error generating A: %v", err)
+	}
+	if bSamples, err = b.generateSoundType(t); err != nil {
+		return nil, nil, fmt.Errorf("error generating B: %v", err)
+	}
+	_, aRMS, _, _ := WaveformStats(aSamples)
+	_, bRMS, _, _ := WaveformStats(bSamples)
+	if aRMS > bRMS {
+		aSamples = MatchLoudness(bSamples, aSamples)
+	} else {
+		bSamples = MatchLoudness(aSamples, bSamples)
+	}
+	return aSamples, bSamples, nil
+}
+
+// GenerateVariation generates the sound with small random deviations in timing, pitch and filter cutoff,
+// which is useful for creating round-robin sample sets. The amount is in the [0, 1] range, where 1 gives
+// up to ±3% pitch, ±15% filter cutoff and 3 ms of delayed onset. The same seed gives the same deviations.
+func (cfg *Settings) GenerateVariation(seed int64, amount float64) ([]float64, error) {
+	if amount < 0 || amount > 1 {
+		return nil, fmt.Errorf("variation amount must be between 0 and 1, got %f", amount)
+	}
+	r := rand.New(rand.NewSource(seed))
+	deviation := func(maxDeviation float64) float64 {
+		return 1 + (r.Float64()*2-1)*maxDeviation*amount
+	}
+	varied := CopySettings(cfg)
+	pitch := deviation(0.03)
+	varied.StartFreq *= pitch
+	varied.EndFreq *= pitch
+	varied.FilterCutoff *= deviation(0.15)
+	delay := int(r.Float64() * amount * 0.003 * float64(cfg.SampleRate))
+
+	samples, err := varied.Generate()
+	if err != nil {
+		return nil, err
+	}
+	if delay <= 0 || delay >= len(samples) {
+		return samples, nil
+	}
+	// Delay the onset while keeping the length of the sound
+	delayed := make([]float64, len(samples))
+	copy(delayed[delay:], samples)
+	return delayed, nil
+}
+
+// speakerAngles returns the angles, in degrees clockwise from the front, of the speakers for the given
+// number of channels, in the channel order that is used by WAV files
+func speakerAngles(channels int) []float64 {
+	switch channels {
+	case 1:
+		return []float64{0}
+	case 2:
+		return []float64{-30, 30}
+	case 4:
+		return []float64{-45, 45, -135, 135}
+	}
+	angles := make([]float64, channels)
+	for i := range angles {
+		angles[i] = 360 * float64(i) / float64(channels)
+	}
+	return angles
+}
+
+// generateSoundType generates the sound type with the given name (see ParseSoundType) with a copy of the
+// settings, instead of the SoundType of the settings
+func (cfg *Settings) generateSoundType(t string) ([]float64, error) {
+	soundType, err := ParseSoundType(t)
+	if err != nil {
+		return nil, err
+	}
+	typeCfg := CopySettings(cfg)
+	typeCfg.SoundType = soundType
+	return typeCfg.Generate()
+}
+
+// GenerateMultichannel generates the sound type with the given name, like "kick" or "snare", and pans it across
+// the given number of channels, returning interleaved samples. SurroundAngle is the direction of the sound in
+// degrees, clockwise from the front. Each speaker gets a gain that falls off with its angle to the sound, and the
+// total power is kept constant.
+func (cfg *Settings) GenerateMultichannel(t string, channels int) ([]float64, error) {
+	if channels <= 0 {
+		return nil, fmt.Errorf("invalid number of channels: %d", channels)
+	}
+	samples, err := cfg.generateSoundType(t)
+	if err != nil {
+		return nil, err
+	}
+	angles := speakerAngles(channels)
+	gains := make([]float64, channels)
+	power := 0.0
+	for c, angle := range angles {
+		gains[c] = (1 + math.Cos((cfg.SurroundAngle-angle)*math.Pi/180)) / 2
+		power += gains[c] * gains[c]
+	}
+	for c := range gains {
+		gains[c] /= math.Sqrt(power)
+	}
+	interleaved := make([]float64, len(samples)*channels)
+	for i, sample := range samples {
+		for c, gain := range gains {
+			interleaved[i*channels+c] = sample * gain
+		}
+	}
+	return interleaved, nil
+}
+
+// ImpulseTrain generates a band-limited impulse train at the given fundamental frequency, as a sum of
+// equally loud cosine harmonics up to the Nyquist frequency. The peaks are normalized to 1.
+// Filtering the impulse train is a good starting point for classic subtractive synthesis.
+func ImpulseTrain(freq float64, length, sampleRate int) []float64 {
+	samples := make([]float64, max(length, 0))
+	if freq <= 0 || sampleRate <= 0 {
+		return samples
+	}
+	numHarmonics := int(math.Ceil(float64(sampleRate)/2/freq)) - 1
+	if numHarmonics < 1 {
+		return samples
+	}
+	for i := range samples {
+		t := float64(i) / float64(sampleRate)
+		sum := 0.0
+		for k := 1; k <= numHarmonics; k++ {
+			sum += math.Cos(2 * math.Pi * float64(k) * freq * t)
+		}
+		samples[i] = sum / float64(numHarmonics)
+	}
+	return samples
+}
+
+// Arpeggiate plays the notes of a chord (as MIDI note numbers) one after another, as 16th notes at the given
+// tempo, for the given number of bars. The notes are generated with the configured sound type, typically
+// Xylophone or Lead. The pattern is "up", "down", "updown" or "random", where the random notes are drawn
+// from randomSource, so that the same settings give the same arpeggio if UseSeed is set.
+func (cfg *Settings) Arpeggiate(chordMidi []int, pattern string, bpm float64, bars int) ([]float64, error) {
+	if len(chordMidi) == 0 {
+		return nil, errors.New("no chord notes to arpeggiate")
+	}
+	if bpm <= 0 || bars <= 0 {
+		return nil, fmt.Errorf("invalid BPM or number of bars: %f, %d", bpm, bars)
+	}
+	ascending := append([]int(nil), chordMidi...)
+	sort.Ints(ascending)
+	var sequence []int
+	switch pattern {
+	case "up", "random":
+		sequence = ascending
+	case "down":
+		for i := len(ascending) - 1; i >= 0; i-- {
+			sequence = append(sequence, ascending[i])
+		}
+	case "updown":
+		sequence = append(sequence, ascending...)
+		for i := len(ascending) - 2; i > 0; i-- {
+			sequence = append(sequence, ascending[i])
+		}
+	default:
+		return nil, fmt.Errorf("unknown arpeggio pattern: %s", pattern)
+	}
+
+	const stepsPerBar = 16
+	stepDuration := 60.0 / bpm / 4
+	stepSamples := int(stepDuration * float64(cfg.SampleRate))
+	arpeggio := make([]float64, stepSamples*stepsPerBar*bars)
+	r := cfg.randomSource()
+	for step := 0; step < stepsPerBar*bars; step++ {
+		note := sequence[step%len(sequence)]
+		if pattern == "random" {
+			note = sequence[r.Intn(len(sequence))]
+		}
+		noteCfg := CopySettings(cfg)
+		noteCfg.StartFreq = MIDINoteToFrequency(note)
+		noteCfg.EndFreq = noteCfg.StartFreq
+		noteCfg.Duration = stepDuration
+		samples, err := noteCfg.Generate()
+		if err != nil {
+			return nil, fmt.Errorf("error generating note %d: %v", note, err)
+		}
+		copy(arpeggio[step*stepSamples:(step+1)*stepSamples], samples)
+	}
+	return arpeggio, nil
+}
+
+// SnapTransient generates a short "snap" or "tick" that can be layered on top of the attack of any drum.
+// It is a sine at the given frequency mixed with noise that is high-passed at the same frequency,
+// with an exponential decay that reaches -60 dB at the end of the duration. The peak is normalized to 1.
+func SnapTransient(freq, durationSec float64, sampleRate int) []float64 {
+	numSamples := int(durationSec * float64(sampleRate))
+	noise := ResonantHighPassFilter(GenerateWhiteNoise(numSamples, 1.0), freq, math.Sqrt2/2, sampleRate)
+	snap := make([]float64, numSamples)
+	decay := durationSec / math.Log(1000)
+	for i := range snap {
+		t := float64(i) / float64(sampleRate)
+		snap[i] = (0.5*math.Sin(2*math.Pi*freq*t) + 0.5*noise[i]) * math.Exp(-t/decay)
+	}
+	return NormalizeSamples(snap, 1.0)
+}
+
 // GenerateWhiteNoise generates white noise
 func GenerateWhiteNoise(length int, amount float64) []float64 {
+	return whiteNoise(nil, length, amount)
+}
+
+// GeneratePinkNoise generates pink noise
+func GeneratePinkNoise(length int, amount float64) []float64 {
+	return pinkNoise(nil, length, amount)
+}
+
+// GenerateBrownNoise generates brown noise
+func GenerateBrownNoise(length int, amount float64) []float64 {
+	return brownNoise(nil, length, amount)
+}
+
+// noiseSource returns the source of randomness for the noise in the generators. If UseSeed is set, the
+// source is seeded with Seed, so that the same settings always produce the exact same sound.
+// Otherwise, nil is returned, for using the global source.
+func (cfg *Settings) noiseSource() *rand.Rand {
+	if !cfg.UseSeed {
+		return nil
+	}
+	return rand.New(rand.NewSource(cfg.Seed))
+}
+
+// randomSource returns the source of randomness for the random variations of the generators, like the clap
+// drift, the pitch drift and the random arpeggio notes. It follows the same rule as noiseSource: if UseSeed is set,
+// the source is seeded with Seed, so that the same settings always give the same variations. Otherwise, the
+// source is seeded from the global source.
+func (cfg *Settings) randomSource() *rand.Rand {
+	if r := cfg.noiseSource(); r != nil {
+		return r
+	}
+	return rand.New(rand.NewSource(rand.Int63()))
+}
+
+// randomFloat returns a random number in the [0, 1) range from r, or from the global source if r is nil
+func randomFloat(r *rand.Rand) float64 {
+	if r == nil {
+		return rand.Float64()
+	}
+	return r.Float64()
+}
+
+// whiteNoise generates white noise, using r as the source of randomness
+func whiteNoise(r *rand.Rand, length int, amount float64) []float64 {
 	noise := make([]float64, length)
 	for i := range noise {
-		noise[i] = (rand.Float64()*2 - 1) * amount
+		noise[i] = (randomFloat(r)*2 - 1) * amount
 	}
 	return noise
 }
 
-// GeneratePinkNoise generates pink noise
-func GeneratePinkNoise(length int, amount float64) []float64 {
+// pinkNoise generates pink noise, using r as the source of randomness
+func pinkNoise(r *rand.Rand, length int, amount float64) []float64 {
 	noise := make([]float64, length)
 	var b0, b1, b2, b3, b4, b5, b6 float64
 	for i := range noise {
-		white := rand.Float64()*2 - 1
+		white := randomFloat(r)*2 - 1
 		b0 = 0.99886*b0 + white*0.0555179
 		b1 = 0.99332*b1 + white*0.0750759
 		b2 = 0.96900*b2 + white*0.1538520
@@ -437,12 +1348,12 @@ func GeneratePinkNoise(length int, amount float64) []float64 {
 	return noise
 }
 
-// GenerateBrownNoise generates brown noise
-func GenerateBrownNoise(length int, amount float64) []float64 {
+// brownNoise generates brown noise, using r as the source of randomness
+func brownNoise(r *rand.Rand, length int, amount float64) []float64 {
 	noise := make([]float64, length)
 	var lastOutput float64
 	for i := range noise {
-		white := (rand.Float64()*2 - 1) * amount / 10
+		white := (randomFloat(r)*2 - 1) * amount / 10
 		value := (lastOutput + (0.02 * white)) / 1.02
 		lastOutput = value
 		value *= 3.5 // (roughly) compensate for gain
@@ -457,29 +1368,109 @@ func GenerateBrownNoise(length int, amount float64) []float64 {
 	return noise
 }
 
+// GenerateWind generates a wind texture for ambience beds, by sweeping pink noise through a resonant band-pass
+// filter with slow LFOs, and slowly modulating the amplitude. The intensity is in the [0, 1] range.
+func GenerateWind(durationSec float64, intensity float64, sampleRate int) []float64 {
+	numSamples := int(durationSec * float64(sampleRate))
+	noise := GeneratePinkNoise(numSamples, clampUnit(intensity))
+	wind := make([]float64, numSamples)
+	var f biquad
+	for i, sample := range noise {
+		t := float64(i) / float64(sampleRate)
+		// Two slow LFOs with unrelated rates, so that the gusts do not repeat in an obvious way
+		sweep := 0.6*math.Sin(2*math.Pi*0.13*t) + 0.4*math.Sin(2*math.Pi*0.29*t+2)
+		f.setBandPass(400*math.Pow(2, 1.5*sweep), 1.5, sampleRate)
+		gust := 0.6 + 0.4*math.Sin(2*math.Pi*0.21*t+1)
+		wind[i] = 2 * f.process(sample) * gust
+	}
+	return Limiter(wind)
+}
+
+// filterFM applies a resonant low-pass filter at FilterCutoff (or 150 Hz if not set), with FilterResonance as
+// the Q, where the cutoff is moved up and down by up to FilterFMAmount octaves by the modulator, at audio rate.
+// The cutoff goes up as the modulator goes down, so that the filter opens up at the start of each sawtooth cycle.
+func (cfg *Settings) filterFM(samples, modulator []float64) []float64 {
+	cutoff := cfg.FilterCutoff
+	if cutoff <= 0 {
+		cutoff = 150.0
+	}
+	q := math.Max(cfg.FilterResonance, math.Sqrt2/2)
+	filtered := make([]float64, len(samples))
+	var f biquad
+	for i, sample := range samples {
+		f.setLowPass(cutoff*math.Pow(2, -cfg.FilterFMAmount*modulator[i]), q, cfg.SampleRate)
+		filtered[i] = f.process(sample)
+	}
+	return filtered
+}
+
 // GenerateBass generates a deep, detuned bass sound typical of deep house
 func (cfg *Settings) GenerateBass() ([]float64, error) {
 	numSamples := int(float64(cfg.SampleRate) * cfg.Duration)
 
-	// Generate detuned sawtooth oscillators for a deep bass sound
-	detune := []float64{-0.01, 0.01} // Slight detuning for a thicker sound
-	bassWave := DetunedOscillators(cfg.StartFreq, detune, numSamples, cfg.SampleRate)
+	// Generate detuned sawtooth oscillators for a deep bass sound, or layer the oscillators if
+	// OscillatorWaveforms is set
+	var bassWave []float64
+	if numOscillators := max(cfg.NumOscillators, len(cfg.OscillatorWaveforms)); len(cfg.OscillatorWaveforms) > 0 && cfg.tonalOscillators(numOscillators) {
+		bassWave = make([]float64, numSamples)
+		phases := cfg.oscillatorPhases(numOscillators)
+		for i := range bassWave {
+			bassWave[i] = cfg.oscillatorLayers(phases, cfg.StartFreq, nil)
+		}
+	} else {
+		detune := []float64{-0.01, 0.01} // Slight detuning for a thicker sound
+		bassWave = DetunedOscillators(cfg.StartFreq, detune, numSamples, cfg.SampleRate)
+	}
+	if cfg.RetroMode {
+		bassWave = retroQuantize(bassWave)
+	}
 
-	// Apply a low-pass filter to keep the bass deep and focused on lower frequencies
-	bassWave = LowPassFilter(bassWave, 150.0, cfg.SampleRate) // Low-pass at 150Hz for deep bass
+	if cfg.FilterFMAmount != 0 {
+		// Drive the oscillators into a resonant low-pass filter, where the cutoff is modulated by the
+		// oscillators themselves, for an aggressive acid sound
+		bassWave = cfg.filterFM(cfg.drive(bassWave), bassWave)
+		bassWave = cfg.applyEnvelope(bassWave)
+	} else {
+		// Apply a low-pass filter to keep the bass deep and focused on lower frequencies
+		bassWave = LowPassFilter(bassWave, 150.0, cfg.SampleRate) // Low-pass at 150Hz for deep bass
 
-	// Apply ADSR envelope for bass dynamics
-	bassWave = ApplyEnvelope(bassWave, cfg.Attack, cfg.Decay, cfg.Sustain, cfg.Release, cfg.SampleRate)
+		// Apply ADSR envelope for bass dynamics
+		bassWave = cfg.applyEnvelope(bassWave)
 
-	// Apply drive to give the bass some extra punch and warmth
-	bassWave = Drive(bassWave, cfg.Drive)
+		// Apply drive to give the bass some extra punch and warmth
+		bassWave = cfg.drive(bassWave)
+	}
 
 	// Limit the amplitude to avoid clipping
-	bassWave = Limiter(bassWave)
+	bassWave = cfg.postProcess(bassWave)
 
 	return bassWave, nil
 }
 
+// MakeSeamlessDrone generates a drone of durationSec seconds that can be looped without a gap or click.
+// It uses the same detuned sawtooth oscillators as cmd/sweep, at StartFreq, low-pass filtered at FilterCutoff.
+// A little more than the requested duration is rendered, and the extra crossfadeSec seconds at the end are
+// crossfaded (with equal power) into the start, so that the end of the drone runs straight into the start.
+func (cfg *Settings) MakeSeamlessDrone(durationSec, crossfadeSec float64) ([]float64, error) {
+	numSamples := int(durationSec * float64(cfg.SampleRate))
+	crossfadeSamples := int(crossfadeSec * float64(cfg.SampleRate))
+	if numSamples <= 0 || crossfadeSamples <= 0 || crossfadeSamples > numSamples {
+		return nil, fmt.Errorf("invalid drone duration or crossfade: %f, %f", durationSec, crossfadeSec)
+	}
+	detune := []float64{-0.01, -0.005, 0.0, 0.005, 0.01}
+	rendered := DetunedOscillators(cfg.StartFreq, detune, numSamples+crossfadeSamples, cfg.SampleRate)
+	rendered = LowPassFilter(rendered, cfg.FilterCutoff, cfg.SampleRate)
+
+	drone := rendered[:numSamples]
+	for i := 0; i < crossfadeSamples; i++ {
+		progress := float64(i) / float64(crossfadeSamples)
+		fadeIn := math.Sin(progress * math.Pi / 2)
+		fadeOut := math.Cos(progress * math.Pi / 2)
+		drone[i] = rendered[i]*fadeIn + rendered[numSamples+i]*fadeOut
+	}
+	return Limiter(drone), nil
+}
+
 // GenerateXylophone generates a xylophone-like sound for arpeggios
 func (cfg *Settings) GenerateXylophone() ([]float64, error) {
 	numSamples := int(float64(cfg.SampleRate) * cfg.Duration)
@@ -488,42 +1479,110 @@ func (cfg *Settings) GenerateXylophone() ([]float64, error) {
 	// Generate a sine wave to simulate the xylophone's tonal character
 	for i := 0; i < numSamples; i++ {
 		t := float64(i) / float64(cfg.SampleRate)
-		frequency := cfg.StartFreq * math.Pow(cfg.EndFreq/cfg.StartFreq, t/cfg.Duration)
-		sample := math.Sin(2 * math.Pi * frequency * t)
-		samples[i] = sample
+		frequency := cfg.sweepFrequency(t)
+		sample := cfg.sin(2 * math.Pi * frequency * t)
+		samples[i] = cfg.retroSample(sample)
 	}
 
 	// Apply a short, sharp ADSR envelope to simulate the percussive attack of a xylophone
-	samples = ApplyEnvelope(samples, cfg.Attack, cfg.Decay, cfg.Sustain, cfg.Release, cfg.SampleRate)
+	samples = cfg.applyEnvelope(samples)
 
 	// Optionally, apply a bit of reverb for depth
 	samples, _ = SchroederReverb(samples, 0.3, []int{1557, 1617, 1491, 1422}, []int{225, 556})
 
 	// Apply limiter to keep everything within the [-1, 1] range
-	samples = Limiter(samples)
+	samples = cfg.postProcess(samples)
 
 	return samples, nil
 }
 
+// pitchDriftInterval is the time, in seconds, between each random target of the pitch drift
+const pitchDriftInterval = 0.25
+
+// pitchDriftCurve returns a slowly wandering pitch offset, in semitones, for each sample. The curve glides
+// smoothly between random targets in the [-PitchDrift, PitchDrift] range, which are drawn from randomSource.
+func (cfg *Settings) pitchDriftCurve(numSamples int) []float64 {
+	r := cfg.randomSource()
+	interval := max(int(pitchDriftInterval*float64(cfg.SampleRate)), 1)
+	targets := make([]float64, numSamples/interval+2)
+	for i := range targets {
+		targets[i] = (2*r.Float64() - 1) * cfg.PitchDrift
+	}
+	curve := make([]float64, numSamples)
+	for i := range curve {
+		n := i / interval
+		// Cosine interpolation between the targets, for a smooth glide
+		x := 0.5 - 0.5*math.Cos(math.Pi*float64(i%interval)/float64(interval))
+		curve[i] = targets[n]*(1-x) + targets[n+1]*x
+	}
+	return curve
+}
+
+// driftingDetunedOscillators works like DetunedOscillators, but the pitch follows the given drift curve, in semitones
+func driftingDetunedOscillators(freq float64, detune, driftCurve []float64, sampleRate int) []float64 {
+	combined := make([]float64, len(driftCurve))
+	for _, d := range detune {
+		phase := 0.0
+		for i, drift := range driftCurve {
+			combined[i] += 2 * (phase - math.Floor(0.5+phase)) / float64(len(detune))
+			phase += freq * (1 + d) * math.Pow(2, drift/12) / float64(sampleRate)
+		}
+	}
+	return combined
+}
+
+// wavetableOscillators works like DetunedOscillators, but the oscillators are read from the Wavetable,
+// at WavetablePosition, modulated by an LFO at WavetableMorphRate. The pitch follows the PitchDrift, if set.
+func (cfg *Settings) wavetableOscillators(freq float64, detune []float64, numSamples int) []float64 {
+	var driftCurve []float64
+	if cfg.PitchDrift > 0 {
+		driftCurve = cfg.pitchDriftCurve(numSamples)
+	}
+	combined := make([]float64, numSamples)
+	for _, d := range detune {
+		phase := 0.0
+		for i := range combined {
+			t := float64(i) / float64(cfg.SampleRate)
+			combined[i] += cfg.Wavetable.Sample(phase, morphPosition(cfg.WavetablePosition, cfg.WavetableMorphRate, t)) / float64(len(detune))
+			ratio := 1 + d
+			if driftCurve != nil {
+				ratio *= math.Pow(2, driftCurve[i]/12)
+			}
+			phase += freq * ratio / float64(cfg.SampleRate)
+		}
+	}
+	return combined
+}
+
 // GenerateLead generates a bright, detuned lead sound
 func (cfg *Settings) GenerateLead() ([]float64, error) {
 	numSamples := int(float64(cfg.SampleRate) * cfg.Duration)
 
-	// Generate detuned sawtooth oscillators for a bright lead sound
+	// Generate detuned sawtooth oscillators for a bright lead sound, or read them from the wavetable, if set
 	detune := []float64{-0.02, 0.02} // Slight detuning for a rich, thick sound
-	leadWave := DetunedOscillators(cfg.StartFreq, detune, numSamples, cfg.SampleRate)
+	var leadWave []float64
+	if cfg.Wavetable != nil {
+		leadWave = cfg.wavetableOscillators(cfg.StartFreq, detune, numSamples)
+	} else if cfg.PitchDrift > 0 {
+		leadWave = driftingDetunedOscillators(cfg.StartFreq, detune, cfg.pitchDriftCurve(numSamples), cfg.SampleRate)
+	} else {
+		leadWave = DetunedOscillators(cfg.StartFreq, detune, numSamples, cfg.SampleRate)
+	}
+	if cfg.RetroMode {
+		leadWave = retroQuantize(leadWave)
+	}
 
 	// Apply an ADSR envelope for the lead sound dynamics
-	leadWave = ApplyEnvelope(leadWave, cfg.Attack, cfg.Decay, cfg.Sustain, cfg.Release, cfg.SampleRate)
+	leadWave = cfg.applyEnvelope(leadWave)
 
-	// Optionally, apply frequency modulation for a more expressive lead
-	leadWave = ApplyFrequencyModulation(leadWave, 5.0, 0.05, cfg.SampleRate) // Slow modulation
+	// Apply a slow and subtle vibrato for a more expressive lead
+	leadWave = ApplyVibrato(leadWave, 5.0, 0.15, cfg.SampleRate)
 
 	// Apply drive for extra brightness and character
-	leadWave = Drive(leadWave, cfg.Drive)
+	leadWave = cfg.drive(leadWave)
 
 	// Limit the amplitude to avoid clipping
-	leadWave = Limiter(leadWave)
+	leadWave = cfg.postProcess(leadWave)
 
 	return leadWave, nil
 }
@@ -3,6 +3,7 @@ module github.com/xyproto/synth
 go 1.23.1
 
 require (
+	github.com/go-audio/wav v1.1.0
 	github.com/xyproto/audioeffects v0.11.1
 	github.com/xyproto/playsample v0.2.1
 )
@@ -10,7 +11,6 @@ require (
 require (
 	github.com/go-audio/audio v1.0.0 // indirect
 	github.com/go-audio/riff v1.0.0 // indirect
-	github.com/go-audio/wav v1.1.0 // indirect
 	github.com/veandco/go-sdl2 v0.4.40 // indirect
 	github.com/xyproto/binary v1.3.3 // indirect
 	github.com/xyproto/env/v2 v2.5.0 // indirect
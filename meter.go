@@ -0,0 +1,54 @@
+package synth
+
+import (
+	"math"
+)
+
+// Meter is a level meter for monitoring audio while it is being streamed. It holds on to the highest peak,
+// which then falls back over time, and keeps track of the RMS level of the most recent buffer.
+type Meter struct {
+	decayFactor float64
+	peakHold    float64
+	rms         float64
+}
+
+// NewMeter creates a new Meter, where the held peak falls to 1/e of its value over decaySec seconds
+// of audio at the given sample rate. A decaySec of 0 or less holds the peak forever.
+func NewMeter(decaySec float64, sampleRate int) *Meter {
+	decayFactor := 1.0
+	if decaySec > 0 && sampleRate > 0 {
+		decayFactor = math.Exp(-1.0 / (decaySec * float64(sampleRate)))
+	}
+	return &Meter{decayFactor: decayFactor}
+}
+
+// Update feeds the next buffer of samples to the meter
+func (m *Meter) Update(samples []float64) {
+	sumSquares := 0.0
+	for _, sample := range samples {
+		m.peakHold *= m.decayFactor
+		if abs := math.Abs(sample); abs > m.peakHold {
+			m.peakHold = abs
+		}
+		sumSquares += sample * sample
+	}
+	if len(samples) > 0 {
+		m.rms = math.Sqrt(sumSquares / float64(len(samples)))
+	}
+}
+
+// PeakHold returns the held peak level
+func (m *Meter) PeakHold() float64 {
+	return m.peakHold
+}
+
+// RMS returns the RMS level of the most recent buffer
+func (m *Meter) RMS() float64 {
+	return m.rms
+}
+
+// Reset clears the held peak and the RMS level
+func (m *Meter) Reset() {
+	m.peakHold = 0
+	m.rms = 0
+}
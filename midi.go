@@ -0,0 +1,355 @@
+package synth
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// MIDIDrumNotes maps Pattern instrument names to General MIDI percussion notes, for use by SaveMIDI
+var MIDIDrumNotes = map[string]int{
+	"kick":       36,
+	"rimshot":    37,
+	"snare":      38,
+	"clap":       39,
+	"closed_hh":  42,
+	"hihat":      42,
+	"tom":        45,
+	"open_hh":    46,
+	"crash":      49,
+	"ride":       51,
+	"percussion": 63,
+}
+
+// MIDIEvent is a note from a MIDI file, where Time and Duration are given in seconds and Velocity is in the [0, 1] range
+type MIDIEvent struct {
+	Time     float64
+	Duration float64
+	Channel  int
+	Note     int
+	Velocity float64
+}
+
+// midiRawEvent is a note-on, note-off or tempo event, with the time given in ticks
+type midiRawEvent struct {
+	tick     int
+	order    int
+	kind     int
+	channel  int
+	note     int
+	velocity int
+	tempo    int
+}
+
+const (
+	midiNoteOff = iota
+	midiNoteOn
+	midiTempo
+)
+
+// MIDINoteToFrequency converts a MIDI note number to a frequency in Hz, where note 69 is A4 at 440 Hz
+func MIDINoteToFrequency(note int) float64 {
+	return 440.0 * math.Pow(2, float64(note-69)/12.0)
+}
+
+// LoadMIDI loads a standard MIDI file (format 0 or 1) and returns the notes it contains, sorted by time
+func LoadMIDI(filename string) ([]MIDIEvent, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading MIDI file: %v", err)
+	}
+	return parseMIDI(data)
+}
+
+// parseMIDI parses the contents of a standard MIDI file
+func parseMIDI(data []byte) ([]MIDIEvent, error) {
+	if len(data) < 14 || string(data[:4]) != "MThd" {
+		return nil, errors.New("invalid MIDI file: missing MThd header")
+	}
+	headerLength := int(binary.BigEndian.Uint32(data[4:8]))
+	if headerLength < 6 || len(data) < 8+headerLength {
+		return nil, errors.New("invalid MIDI file: short header")
+	}
+	numTracks := int(binary.BigEndian.Uint16(data[10:12]))
+	division := binary.BigEndian.Uint16(data[12:14])
+	if division == 0 {
+		return nil, errors.New("invalid MIDI file: time division is 0")
+	}
+
+	var raw []midiRawEvent
+	pos := 8 + headerLength
+	for track := 0; track < numTracks; track++ {
+		if pos+8 > len(data) {
+			return nil, fmt.Errorf("invalid MIDI file: missing track %d", track)
+		}
+		trackLength := int(binary.BigEndian.Uint32(data[pos+4 : pos+8]))
+		if string(data[pos:pos+4]) != "MTrk" || pos+8+trackLength > len(data) {
+			return nil, fmt.Errorf("invalid MIDI file: bad track %d", track)
+		}
+		events, err := parseMIDITrack(data[pos+8:pos+8+trackLength], len(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid MIDI file: track %d: %v", track, err)
+		}
+		raw = append(raw, events...)
+		pos += 8 + trackLength
+	}
+	sort.SliceStable(raw, func(i, j int) bool {
+		if raw[i].tick != raw[j].tick {
+			return raw[i].tick < raw[j].tick
+		}
+		return raw[i].order < raw[j].order
+	})
+
+	// Convert ticks to seconds, following the tempo changes
+	secondsPerTick := func(tempo int) float64 {
+		if division&0x8000 != 0 { // SMPTE time division
+			framesPerSecond := float64(-int8(division >> 8))
+			ticksPerFrame := float64(division & 0xff)
+			return 1.0 / (framesPerSecond * ticksPerFrame)
+		}
+		return float64(tempo) / 1e6 / float64(division)
+	}
+	tempo := 500000 // 120 BPM
+	lastTick, lastTime := 0, 0.0
+	times := make([]float64, len(raw))
+	for i, e := range raw {
+		lastTime += float64(e.tick-lastTick) * secondsPerTick(tempo)
+		lastTick = e.tick
+		times[i] = lastTime
+		if e.kind == midiTempo {
+			tempo = e.tempo
+		}
+	}
+
+	// Pair note-on events with their note-off events
+	var notes []MIDIEvent
+	playing := make(map[int][]int)
+	for i, e := range raw {
+		key := e.channel<<8 | e.note
+		switch e.kind {
+		case midiNoteOn:
+			notes = append(notes, MIDIEvent{Time: times[i], Channel: e.channel, Note: e.note, Velocity: float64(e.velocity) / 127.0})
+			playing[key] = append(playing[key], len(notes)-1)
+		case midiNoteOff:
+			if started := playing[key]; len(started) > 0 {
+				notes[started[0]].Duration = times[i] - notes[started[0]].Time
+				playing[key] = started[1:]
+			}
+		}
+	}
+	// Notes that are never turned off last until the end of the file
+	for _, started := range playing {
+		for _, n := range started {
+			notes[n].Duration = lastTime - notes[n].Time
+		}
+	}
+	return notes, nil
+}
+
+// parseMIDITrack parses the events in a single MTrk chunk. The order offset is used for stable sorting across tracks.
+func parseMIDITrack(data []byte, orderOffset int) ([]midiRawEvent, error) {
+	var events []midiRawEvent
+	pos, tick := 0, 0
+	var status byte
+	readVarLen := func() (int, error) {
+		value := 0
+		for i := 0; i < 4; i++ {
+			if pos >= len(data) {
+				return 0, errors.New("unexpected end of track")
+			}
+			b := data[pos]
+			pos++
+			value = value<<7 | int(b&0x7f)
+			if b&0x80 == 0 {
+				return value, nil
+			}
+		}
+		return 0, errors.New("variable length value is too long")
+	}
+	for pos < len(data) {
+		delta, err := readVarLen()
+		if err != nil {
+			return nil, err
+		}
+		tick += delta
+		if pos >= len(data) {
+			return nil, errors.New("unexpected end of track")
+		}
+		if data[pos]&0x80 != 0 {
+			status = data[pos]
+			pos++
+		} else if status == 0 {
+			return nil, errors.New("running status without a previous status byte")
+		}
+		switch {
+		case status == 0xff: // meta event
+			if pos >= len(data) {
+				return nil, errors.New("unexpected end of track")
+			}
+			metaType := data[pos]
+			pos++
+			length, err := readVarLen()
+			if err != nil {
+				return nil, err
+			}
+			if pos+length > len(data) {
+				return nil, errors.New("unexpected end of track")
+			}
+			if metaType == 0x51 && length == 3 {
+				tempo := int(data[pos])<<16 | int(data[pos+1])<<8 | int(data[pos+2])
+				events = append(events, midiRawEvent{tick: tick, order: orderOffset + len(events), kind: midiTempo, tempo: tempo})
+			}
+			pos += length
+			status = 0 // meta events cancel the running status
+			if metaType == 0x2f {
+				return events, nil
+			}
+		case status == 0xf0 || status == 0xf7: // sysex event
+			length, err := readVarLen()
+			if err != nil {
+				return nil, err
+			}
+			pos += length
+			status = 0
+		default:
+			dataBytes := 2
+			if kind := status & 0xf0; kind == 0xc0 || kind == 0xd0 {
+				dataBytes = 1
+			}
+			if pos+dataBytes > len(data) {
+				return nil, errors.New("unexpected end of track")
+			}
+			channel := int(status & 0x0f)
+			switch status & 0xf0 {
+			case 0x90:
+				kind := midiNoteOn
+				if data[pos+1] == 0 {
+					kind = midiNoteOff
+				}
+				events = append(events, midiRawEvent{tick: tick, order: orderOffset + len(events), kind: kind, channel: channel, note: int(data[pos]), velocity: int(data[pos+1])})
+			case 0x80:
+				events = append(events, midiRawEvent{tick: tick, order: orderOffset + len(events), kind: midiNoteOff, channel: channel, note: int(data[pos])})
+			}
+			pos += dataBytes
+		}
+	}
+	return events, nil
+}
+
+// RenderMIDI renders the given MIDI notes to a single buffer of interleaved samples.
+// The instrument function returns the Settings that are used for generating each note
+// (or nil if the note should be skipped), and each generated note is scaled by its velocity.
+func RenderMIDI(events []MIDIEvent, instrument func(note int, velocity float64) *Settings, sampleRate, bitDepth, channels int) ([]float64, error) {
+	if sampleRate <= 0 || channels <= 0 {
+		return nil, errors.New("invalid sample rate or channels")
+	}
+	var mixed []float64
+	for _, e := range events {
+		cfg := instrument(e.Note, e.Velocity)
+		if cfg == nil {
+			continue
+		}
+		cfg.SampleRate = sampleRate
+		cfg.BitDepth = bitDepth
+		cfg.Channels = channels
+		samples, err := cfg.Generate()
+		if err != nil {
+			return nil, fmt.Errorf("error generating note %d at %.3fs: %v", e.Note, e.Time, err)
+		}
+		offset := int(e.Time*float64(sampleRate)) * channels
+		if needed := offset + len(samples)*channels; needed > len(mixed) {
+			mixed = append(mixed, make([]float64, needed-len(mixed))...)
+		}
+		for i, sample := range samples {
+			for c := 0; c < channels; c++ {
+				mixed[offset+i*channels+c] += sample * e.Velocity
+			}
+		}
+	}
+	if len(mixed) == 0 {
+		return nil, errors.New("no notes were rendered")
+	}
+	return Limiter(mixed), nil
+}
+
+// SaveMIDI writes the given pattern as a standard MIDI file (format 0) on the General MIDI percussion channel,
+// using MIDIDrumNotes to find the note for each instrument
+func SaveMIDI(filename string, pattern *Pattern) error {
+	const ticksPerQuarter = 480
+	const ticksPerBar = 4 * ticksPerQuarter
+	const channel = 9 // General MIDI percussion
+	if pattern == nil {
+		return errors.New("no pattern given")
+	}
+	if pattern.BPM <= 0 {
+		return fmt.Errorf("invalid BPM: %f", pattern.BPM)
+	}
+	type timedEvent struct {
+		tick int
+		data []byte
+	}
+	var events []timedEvent
+	for _, s := range pattern.Steps {
+		note, ok := MIDIDrumNotes[s.Instrument]
+		if !ok {
+			return fmt.Errorf("no MIDI note for instrument: %s", s.Instrument)
+		}
+		if s.StepsPerBar <= 0 {
+			return fmt.Errorf("invalid number of steps per bar: %d", s.StepsPerBar)
+		}
+		velocity := int(math.Round(s.Velocity * 127))
+		if velocity < 1 {
+			velocity = 1
+		} else if velocity > 127 {
+			velocity = 127
+		}
+		start := int(math.Round(float64(s.Step) * ticksPerBar / float64(s.StepsPerBar)))
+		length := ticksPerBar / s.StepsPerBar / 2
+		if length < 1 {
+			length = 1
+		}
+		events = append(events,
+			timedEvent{start, []byte{0x90 | channel, byte(note), byte(velocity)}},
+			timedEvent{start + length, []byte{0x80 | channel, byte(note), 0}})
+	}
+	// Sort by time, with note-off events before note-on events at the same tick
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].tick != events[j].tick {
+			return events[i].tick < events[j].tick
+		}
+		return events[i].data[0]&0xf0 < events[j].data[0]&0xf0
+	})
+
+	tempo := int(math.Round(60e6 / pattern.BPM))
+	track := []byte{0x00, 0xff, 0x51, 0x03, byte(tempo >> 16), byte(tempo >> 8), byte(tempo)}
+	lastTick := 0
+	for _, e := range events {
+		track = append(track, encodeVarLen(e.tick-lastTick)...)
+		track = append(track, e.data...)
+		lastTick = e.tick
+	}
+	track = append(track, encodeVarLen(ticksPerBar-min(lastTick, ticksPerBar))...)
+	track = append(track, 0xff, 0x2f, 0x00) // end of track
+
+	data := []byte("MThd")
+	data = binary.BigEndian.AppendUint32(data, 6)
+	data = binary.BigEndian.AppendUint16(data, 0) // format 0
+	data = binary.BigEndian.AppendUint16(data, 1) // one track
+	data = binary.BigEndian.AppendUint16(data, ticksPerQuarter)
+	data = append(data, "MTrk"...)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(track)))
+	data = append(data, track...)
+	return os.WriteFile(filename, data, 0o644)
+}
+
+// encodeVarLen encodes a value as a MIDI variable length quantity
+func encodeVarLen(value int) []byte {
+	encoded := []byte{byte(value & 0x7f)}
+	for value >>= 7; value > 0; value >>= 7 {
+		encoded = append([]byte{byte(value&0x7f) | 0x80}, encoded...)
+	}
+	return encoded
+}
@@ -55,6 +55,7 @@ func NewSettings(output io.WriteSeeker, startFreq, endFreq, duration float64, sa
 		FilterBands:                []float64{200.0, 1000.0, 3000.0}, // Multi-band filter frequencies
 		FadeDuration:               0.01,                             // Fade in/out duration in seconds
 		SmoothFrequencyTransitions: true,                             // Enable smooth frequency transitions by default
+		OutputGain:                 1.0,                              // Output gain, applied at the end of generation
 	}, nil
 }
 
@@ -319,6 +320,7 @@ func NewSnareSettings(output io.WriteSeeker, sampleRate, bitDepth, channels int)
 		FilterBands:                []float64{500.0, 2000.0, 6000.0}, // Example multi-band frequencies
 		FadeDuration:               0.01,                             // Quick fade to prevent clicks
 		SmoothFrequencyTransitions: true,                             // Enable smooth transitions
+		OutputGain:                 1.48,                             // Calibrated to match the other presets
 	}, nil
 }
 
@@ -345,6 +347,7 @@ func New606(soundType SoundType, output io.WriteSeeker, duration float64, sample
 		cfg.PitchDecay = 0.6
 		cfg.FadeDuration = 0.008
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 0.51
 	case Snare:
 		cfg, err = NewSettings(output, 350.0, 200.0, duration, sampleRate, bitDepth, channels)
 		if err != nil {
@@ -362,6 +365,7 @@ func New606(soundType SoundType, output io.WriteSeeker, duration float64, sample
 		cfg.FilterResonance = 1.2
 		cfg.FadeDuration = 0.01
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 2.3
 	case Clap:
 		cfg, err = NewSettings(output, 400.0, 300.0, duration, sampleRate, bitDepth, channels)
 		if err != nil {
@@ -379,6 +383,7 @@ func New606(soundType SoundType, output io.WriteSeeker, duration float64, sample
 		cfg.FilterResonance = 1.0
 		cfg.FadeDuration = 0.005
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 0.74
 	default:
 		return nil, errors.New("unsupported sound type for New606")
 	}
@@ -408,6 +413,7 @@ func New707(soundType SoundType, output io.WriteSeeker, duration float64, sample
 		cfg.PitchDecay = 0.5
 		cfg.FadeDuration = 0.01
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 0.6
 	case Snare:
 		cfg, err = NewSettings(output, 300.0, 150.0, duration, sampleRate, bitDepth, channels)
 		if err != nil {
@@ -425,6 +431,7 @@ func New707(soundType SoundType, output io.WriteSeeker, duration float64, sample
 		cfg.FilterResonance = 1.0
 		cfg.FadeDuration = 0.008
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 0.97
 	case Clap:
 		cfg, err = NewSettings(output, 450.0, 300.0, duration, sampleRate, bitDepth, channels)
 		if err != nil {
@@ -442,6 +449,7 @@ func New707(soundType SoundType, output io.WriteSeeker, duration float64, sample
 		cfg.FilterResonance = 1.1
 		cfg.FadeDuration = 0.006
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 0.72
 	default:
 		return nil, errors.New("unsupported sound type for New707")
 	}
@@ -471,6 +479,7 @@ func New808(soundType SoundType, output io.WriteSeeker, duration float64, sample
 		cfg.PitchDecay = 0.9
 		cfg.FadeDuration = 0.005
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 0.48
 	case Snare:
 		cfg, err = NewSettings(output, 240.0, 120.0, duration, sampleRate, bitDepth, channels)
 		if err != nil {
@@ -488,6 +497,7 @@ func New808(soundType SoundType, output io.WriteSeeker, duration float64, sample
 		cfg.FilterResonance = 1.5
 		cfg.FadeDuration = 0.015
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 1.05
 	case Clap:
 		cfg, err = NewSettings(output, 300.0, 200.0, duration, sampleRate, bitDepth, channels)
 		if err != nil {
@@ -505,6 +515,7 @@ func New808(soundType SoundType, output io.WriteSeeker, duration float64, sample
 		cfg.FilterResonance = 1.2
 		cfg.FadeDuration = 0.01
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 0.72
 	default:
 		return nil, errors.New("unsupported sound type for New808")
 	}
@@ -534,6 +545,7 @@ func New909(soundType SoundType, output io.WriteSeeker, duration float64, sample
 		cfg.PitchDecay = 0.6
 		cfg.FadeDuration = 0.005
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 0.58
 	case Snare:
 		cfg, err = NewSettings(output, 250.0, 130.0, duration, sampleRate, bitDepth, channels)
 		if err != nil {
@@ -551,6 +563,7 @@ func New909(soundType SoundType, output io.WriteSeeker, duration float64, sample
 		cfg.FilterResonance = 1.3
 		cfg.FadeDuration = 0.012
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 1.12
 	case Clap:
 		cfg, err = NewSettings(output, 350.0, 250.0, duration, sampleRate, bitDepth, channels)
 		if err != nil {
@@ -568,6 +581,7 @@ func New909(soundType SoundType, output io.WriteSeeker, duration float64, sample
 		cfg.FilterResonance = 1.2
 		cfg.FadeDuration = 0.009
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 0.71
 	default:
 		return nil, errors.New("unsupported sound type for New909")
 	}
@@ -597,6 +611,7 @@ func NewLinn(soundType SoundType, output io.WriteSeeker, duration float64, sampl
 		cfg.PitchDecay = 0.5
 		cfg.FadeDuration = 0.015
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 0.37
 	case Snare:
 		cfg, err = NewSettings(output, 260.0, 140.0, duration, sampleRate, bitDepth, channels)
 		if err != nil {
@@ -614,6 +629,7 @@ func NewLinn(soundType SoundType, output io.WriteSeeker, duration float64, sampl
 		cfg.FilterResonance = 1.1
 		cfg.FadeDuration = 0.01
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 0.98
 	case Clap:
 		cfg, err = NewSettings(output, 380.0, 280.0, duration, sampleRate, bitDepth, channels)
 		if err != nil {
@@ -631,6 +647,7 @@ func NewLinn(soundType SoundType, output io.WriteSeeker, duration float64, sampl
 		cfg.FilterResonance = 1.0
 		cfg.FadeDuration = 0.008
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 0.71
 	default:
 		return nil, errors.New("unsupported sound type for NewLinn")
 	}
@@ -660,6 +677,7 @@ func NewDeepHouse(soundType SoundType, output io.WriteSeeker, duration float64,
 		cfg.PitchDecay = 0.75
 		cfg.FadeDuration = 0.02
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 0.47
 	case Snare:
 		cfg, err = NewSettings(output, 220.0, 110.0, duration, sampleRate, bitDepth, channels)
 		if err != nil {
@@ -677,6 +695,7 @@ func NewDeepHouse(soundType SoundType, output io.WriteSeeker, duration float64,
 		cfg.FilterResonance = 1.5
 		cfg.FadeDuration = 0.02
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 1.02
 	case Clap:
 		cfg, err = NewSettings(output, 350.0, 250.0, duration, sampleRate, bitDepth, channels)
 		if err != nil {
@@ -694,6 +713,7 @@ func NewDeepHouse(soundType SoundType, output io.WriteSeeker, duration float64,
 		cfg.FilterResonance = 1.2
 		cfg.FadeDuration = 0.015
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 0.7
 	default:
 		return nil, errors.New("unsupported sound type for NewDeepHouse")
 	}
@@ -723,6 +743,7 @@ func NewExperimental(soundType SoundType, output io.WriteSeeker, duration float6
 		cfg.PitchDecay = 0.9
 		cfg.FadeDuration = 0.01
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 0.54
 	case Snare:
 		cfg, err = NewSettings(output, 400.0, 100.0, duration, sampleRate, bitDepth, channels)
 		if err != nil {
@@ -740,6 +761,7 @@ func NewExperimental(soundType SoundType, output io.WriteSeeker, duration float6
 		cfg.FilterResonance = 1.7
 		cfg.FadeDuration = 0.02
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 0.88
 	case Clap:
 		cfg, err = NewSettings(output, 500.0, 250.0, duration, sampleRate, bitDepth, channels)
 		if err != nil {
@@ -757,6 +779,7 @@ func NewExperimental(soundType SoundType, output io.WriteSeeker, duration float6
 		cfg.FilterResonance = 1.8
 		cfg.FadeDuration = 0.012
 		cfg.SmoothFrequencyTransitions = true
+		cfg.OutputGain = 0.75
 	default:
 		return nil, errors.New("unsupported sound type for NewExperimental")
 	}
@@ -794,5 +817,6 @@ func NewClapSettings(output io.WriteSeeker, sampleRate, bitDepth, channels int)
 		OscillatorLevels:           []float64{1.0},                   // Oscillator level
 		SaturatorAmount:            0.3,                              // Saturation amount
 		FilterBands:                []float64{500.0, 2000.0, 6000.0}, // Multi-band filter frequencies
+		OutputGain:                 0.73,                             // Calibrated to match the other presets
 	}, nil
 }
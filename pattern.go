@@ -0,0 +1,170 @@
+package synth
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// PatternStep is a single hit in a Pattern, placed on a step grid that is divided into StepsPerBar steps
+type PatternStep struct {
+	Instrument  string
+	StepsPerBar int
+	Step        int
+	Velocity    float64
+}
+
+// Pattern is a one bar sequencer pattern in 4/4, where each instrument can run on its own step grid
+type Pattern struct {
+	BPM         float64
+	StepsPerBar int
+	Steps       []PatternStep
+}
+
+// NewPattern creates a new and empty pattern with the given tempo and default step grid
+func NewPattern(bpm float64, stepsPerBar int) (*Pattern, error) {
+	if bpm <= 0 || stepsPerBar <= 0 {
+		return nil, errors.New("invalid BPM or steps per bar")
+	}
+	return &Pattern{BPM: bpm, StepsPerBar: stepsPerBar}, nil
+}
+
+// SetStep places a hit for the given instrument on the default step grid of the pattern.
+// A velocity of 0 removes the hit.
+func (p *Pattern) SetStep(instrument string, step int, velocity float64) error {
+	return p.SetPolyStep(instrument, p.StepsPerBar, step, velocity)
+}
+
+// SetPolyStep places a hit for the given instrument on a step grid with stepsPerBar steps,
+// which makes it possible to let instruments play polyrhythms within the same bar
+// (for instance a kick on a 4 step grid and a hi-hat on a 6 step grid).
+// A velocity of 0 removes the hit.
+func (p *Pattern) SetPolyStep(instrument string, stepsPerBar, step int, velocity float64) error {
+	if stepsPerBar <= 0 {
+		return fmt.Errorf("invalid steps per bar: %d", stepsPerBar)
+	}
+	if step < 0 || step >= stepsPerBar {
+		return fmt.Errorf("step %d is out of range for a grid of %d steps", step, stepsPerBar)
+	}
+	for i, s := range p.Steps {
+		if s.Instrument == instrument && s.StepsPerBar == stepsPerBar && s.Step == step {
+			if velocity <= 0 {
+				p.Steps = append(p.Steps[:i], p.Steps[i+1:]...)
+			} else {
+				p.Steps[i].Velocity = velocity
+			}
+			return nil
+		}
+	}
+	if velocity > 0 {
+		p.Steps = append(p.Steps, PatternStep{Instrument: instrument, StepsPerBar: stepsPerBar, Step: step, Velocity: velocity})
+	}
+	return nil
+}
+
+// BarDuration returns the duration of one bar in seconds
+func (p *Pattern) BarDuration() float64 {
+	return 4 * 60.0 / p.BPM
+}
+
+// Onsets returns the sorted sample offsets, from the start of the bar, where the given instrument is triggered
+func (p *Pattern) Onsets(instrument string, sampleRate int) []int {
+	barSamples := p.BarDuration() * float64(sampleRate)
+	var onsets []int
+	for _, s := range p.Steps {
+		if s.Instrument == instrument {
+			onsets = append(onsets, int(float64(s.Step)*barSamples/float64(s.StepsPerBar)))
+		}
+	}
+	sort.Ints(onsets)
+	return onsets
+}
+
+// QuantizeOnsets moves the given onsets (sample offsets) towards the nearest line of a grid that is gridSamples
+// long, for tightening the timing. A strength of 1 snaps the onsets to the grid, a strength of 0 leaves them
+// where they are, and values in between move them part of the way.
+func QuantizeOnsets(onsets []int, gridSamples int, strength float64) []int {
+	quantized := make([]int, len(onsets))
+	strength = clampUnit(strength)
+	for i, onset := range onsets {
+		if gridSamples <= 0 {
+			quantized[i] = onset
+			continue
+		}
+		nearest := int(math.Round(float64(onset)/float64(gridSamples))) * gridSamples
+		quantized[i] = onset + int(math.Round(float64(nearest-onset)*strength))
+	}
+	return quantized
+}
+
+// GenerateGroove generates a random but plausible drum groove with the given number of steps per bar,
+// as on/off steps for "kick", "snare" and "closed_hh". The kick favors the strong beats, the snare lands
+// on the backbeats (beat 2 and 4) and the hi-hats fill in. A density of 0 gives empty patterns, while
+// a density of 1 gives busy patterns. At high tempos, the hi-hats on the 16th notes are thinned out.
+func GenerateGroove(bpm float64, steps int, density float64, rng *rand.Rand) map[string][]bool {
+	density = clampUnit(density)
+	groove := map[string][]bool{
+		"kick":      make([]bool, steps),
+		"snare":     make([]bool, steps),
+		"closed_hh": make([]bool, steps),
+	}
+	stepsPerBeat := max(steps/4, 1)
+	chance := func(probability float64) bool {
+		return density > 0 && rng.Float64() < probability
+	}
+	for step := 0; step < steps; step++ {
+		beat, offset := step/stepsPerBeat, step%stepsPerBeat
+		onBeat := offset == 0
+		onEighth := stepsPerBeat%2 == 0 && offset == stepsPerBeat/2
+		backbeat := onBeat && beat%2 == 1
+		switch {
+		case step == 0:
+			groove["kick"][step] = density > 0
+		case onBeat && !backbeat:
+			groove["kick"][step] = chance(0.5 + density/2)
+		case onEighth || !onBeat:
+			groove["kick"][step] = chance(density * 0.25)
+		}
+		if backbeat {
+			groove["snare"][step] = chance(2 * density)
+		} else if !onBeat {
+			groove["snare"][step] = chance(density * 0.1) // ghost notes
+		}
+		hatProbability := density
+		if !onBeat && !onEighth && bpm > 140 {
+			hatProbability /= 2
+		}
+		groove["closed_hh"][step] = chance(hatProbability)
+	}
+	return groove
+}
+
+// GrooveToPattern creates a Pattern from a groove, such as the one returned by GenerateGroove,
+// where each instrument runs on a grid with as many steps as it has in the groove
+func GrooveToPattern(bpm float64, groove map[string][]bool) (*Pattern, error) {
+	stepsPerBar := 0
+	for _, steps := range groove {
+		stepsPerBar = max(stepsPerBar, len(steps))
+	}
+	p, err := NewPattern(bpm, max(stepsPerBar, 1))
+	if err != nil {
+		return nil, err
+	}
+	instruments := make([]string, 0, len(groove))
+	for instrument := range groove {
+		instruments = append(instruments, instrument)
+	}
+	sort.Strings(instruments)
+	for _, instrument := range instruments {
+		for step, on := range groove[instrument] {
+			if on {
+				if err := p.SetPolyStep(instrument, len(groove[instrument]), step, 1.0); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,122 @@
+package synth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/xyproto/playsample"
+)
+
+// RenderSequence generates the sounds for each of the given settings, and places them back to back,
+// with gapSec seconds of silence after each sound. The sounds are resampled to the sample rate of the first
+// settings, if needed. Each sound is generated for the sound type in its settings.
+func RenderSequence(cfgs []*Settings, gapSec float64) ([]float64, error) {
+	if len(cfgs) == 0 {
+		return nil, errors.New("no settings to render")
+	}
+	if gapSec < 0 {
+		return nil, fmt.Errorf("invalid gap: %f", gapSec)
+	}
+	sampleRate := cfgs[0].SampleRate
+	gap := make([]float64, int(gapSec*float64(sampleRate)))
+	var sequence []float64
+	for i, cfg := range cfgs {
+		samples, err := cfg.Generate()
+		if err != nil {
+			return nil, fmt.Errorf("error generating sound %d (%s): %v", i+1, cfg.SoundType, err)
+		}
+		samples = ResampleSinc(samples, cfg.SampleRate, sampleRate, 32)
+		sequence = append(sequence, samples...)
+		sequence = append(sequence, gap...)
+	}
+	return sequence, nil
+}
+
+// PlaySequence generates the sounds for each of the given settings and plays them back to back with the
+// given player, with gapSec seconds of silence after each sound. It returns when the playback is done.
+func PlaySequence(player *playsample.Player, cfgs []*Settings, gapSec float64) error {
+	sequence, err := RenderSequence(cfgs, gapSec)
+	if err != nil {
+		return err
+	}
+	return player.PlayWaveform(sequence, cfgs[0].SampleRate, cfgs[0].BitDepth, 1)
+}
+
+// fillStartVelocity is the velocity of the first hit of a fill, which then rises to full velocity
+const fillStartVelocity = 0.4
+
+// fillHitDuration is the length of each hit of a fill, in seconds
+const fillHitDuration = 0.3
+
+// fillToms are the start frequencies and the pan positions of the high, mid and low tom of a fill
+var fillToms = []struct{ Freq, Pan float64 }{{220, 0.3}, {160, 0}, {110, -0.3}}
+
+// newFillTom creates the settings for a tom of a fill, which drops slightly in pitch
+func newFillTom(freq float64, sampleRate, bitDepth int) (*Settings, error) {
+	cfg, err := NewSettings(nil, freq, freq*0.8, fillHitDuration, sampleRate, bitDepth, 1)
+	if err != nil {
+		return nil, err
+	}
+	cfg.SoundType = Tom
+	cfg.Attack = 0.001
+	cfg.Decay = 0.15
+	cfg.Sustain = 0
+	cfg.Release = 0.1
+	cfg.NoiseAmount = 0.2
+	cfg.Drive = 1
+	cfg.OutputGain = 0.5 // about the level of the snare
+	return cfg, nil
+}
+
+// GenerateFill generates a drum fill of sixteenth notes over lengthBeats beats, where the velocity rises from
+// a soft start to full velocity at the end. The style is "snare" for a snare roll, "toms" for a run down
+// from the high to the low tom, or "mixed" for snare hits that alternate with the toms. The samples are
+// interleaved for the given number of channels, with the toms panned from right to left.
+func GenerateFill(style string, lengthBeats int, bpm float64, sampleRate, bitDepth, channels int) ([]float64, error) {
+	if lengthBeats <= 0 || bpm <= 0 || sampleRate <= 0 || channels <= 0 {
+		return nil, errors.New("invalid length, BPM, sample rate or channels")
+	}
+	snareCfg, err := New808(Snare, nil, fillHitDuration, sampleRate, bitDepth, 1)
+	if err != nil {
+		return nil, err
+	}
+	snare, err := snareCfg.Generate()
+	if err != nil {
+		return nil, fmt.Errorf("error generating snare: %v", err)
+	}
+	toms := make([][]float64, len(fillToms))
+	for i, tom := range fillToms {
+		tomCfg, err := newFillTom(tom.Freq, sampleRate, bitDepth)
+		if err != nil {
+			return nil, err
+		}
+		if toms[i], err = tomCfg.Generate(); err != nil {
+			return nil, fmt.Errorf("error generating tom: %v", err)
+		}
+	}
+
+	hits := lengthBeats * 4
+	stepFrames := int(60 / bpm / 4 * float64(sampleRate))
+	var fill []float64
+	for i := 0; i < hits; i++ {
+		velocity := fillStartVelocity + (1-fillStartVelocity)*float64(i)/float64(max(hits-1, 1))
+		// The toms run from high to low over the fill
+		tom := fillToms[i*len(fillToms)/hits]
+		tomSamples := toms[i*len(fillToms)/hits]
+		switch style {
+		case "snare":
+			fill = MixInto(fill, snare, i*stepFrames, channels, velocity, 0)
+		case "toms":
+			fill = MixInto(fill, tomSamples, i*stepFrames, channels, velocity, tom.Pan)
+		case "mixed":
+			if i%2 == 0 {
+				fill = MixInto(fill, snare, i*stepFrames, channels, velocity, 0)
+			} else {
+				fill = MixInto(fill, tomSamples, i*stepFrames, channels, velocity, tom.Pan)
+			}
+		default:
+			return nil, fmt.Errorf("unknown fill style: %s", style)
+		}
+	}
+	return Limiter(fill), nil
+}
@@ -0,0 +1,138 @@
+package synth
+
+import (
+	"math"
+	"math/bits"
+	"math/cmplx"
+)
+
+// nextPowerOfTwo returns the smallest power of two that is at least n, and at least 1
+func nextPowerOfTwo(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	return 1 << bits.Len(uint(n-1))
+}
+
+// fft computes the discrete Fourier transform of x in place, with the iterative radix-2 Cooley-Tukey algorithm.
+// The length of x must be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+	// Reorder the input in bit reversed order
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
+
+// ifft computes the inverse discrete Fourier transform of x in place. The length of x must be a power of two.
+func ifft(x []complex128) {
+	for i := range x {
+		x[i] = cmplx.Conj(x[i])
+	}
+	fft(x)
+	scale := 1 / float64(len(x))
+	for i := range x {
+		x[i] = cmplx.Conj(x[i]) * complex(scale, 0)
+	}
+}
+
+// spectrumAt returns the spectrum of the frame of len(window) samples that starts at the given position,
+// after applying the window. Samples outside of the input are taken to be zero.
+func spectrumAt(samples []float64, start int, window []float64) []complex128 {
+	frame := make([]complex128, len(window))
+	for n, w := range window {
+		if i := start + n; i >= 0 && i < len(samples) {
+			frame[n] = complex(samples[i]*w, 0)
+		}
+	}
+	fft(frame)
+	return frame
+}
+
+// stft returns the short-time Fourier transform of the samples, as the spectrum of each Hann windowed frame
+// of fftSize samples, where the frames start hop samples apart. The last frames are zero padded.
+// fftSize must be a power of two.
+func stft(samples []float64, fftSize, hop int) [][]complex128 {
+	window := Window(fftSize, WindowHann)
+	var frames [][]complex128
+	for start := 0; start < len(samples); start += hop {
+		frames = append(frames, spectrumAt(samples, start, window))
+	}
+	return frames
+}
+
+// spectrogramFrameDuration is the length of the frames of SpectrogramFrames, in seconds, if no frame size is given
+const spectrogramFrameDuration = 0.02
+
+// SpectrogramFrames returns the magnitude spectrum of each frame of the samples, for drawing a spectrogram.
+// The frames are Hann windowed and start hop samples apart, and each spectrum has frameSize/2+1 bins, where
+// bin k is at k*sampleRate/frameSize Hz. The magnitudes are scaled so that a full scale sine wave gives a peak
+// of about 1. frameSize is rounded up to a power of two, a frameSize of 0 gives frames of about 20 ms, and a
+// hop of 0 gives a quarter of the frame size.
+func SpectrogramFrames(samples []float64, frameSize, hop, sampleRate int) [][]float64 {
+	if frameSize <= 0 {
+		frameSize = int(spectrogramFrameDuration * float64(sampleRate))
+	}
+	frameSize = nextPowerOfTwo(frameSize)
+	if hop <= 0 {
+		hop = max(frameSize/4, 1)
+	}
+	windowSum := 0.0
+	for _, w := range Window(frameSize, WindowHann) {
+		windowSum += w
+	}
+	spectra := stft(samples, frameSize, hop)
+	frames := make([][]float64, len(spectra))
+	for i, spectrum := range spectra {
+		magnitudes := make([]float64, frameSize/2+1)
+		for k := range magnitudes {
+			magnitudes[k] = 2 * cmplx.Abs(spectrum[k]) / windowSum
+		}
+		frames[i] = magnitudes
+	}
+	return frames
+}
+
+// crossCorrelation returns the cross-correlation of a and b, computed with an FFT, where element l is the sum of
+// a[i]*b[i+l] over all i. The result is long enough for the correlation not to wrap around, and the negative
+// lags are found at the end, so that lag -l is at element len-l.
+func crossCorrelation(a, b []float64) []float64 {
+	n := nextPowerOfTwo(len(a) + len(b))
+	fa := make([]complex128, n)
+	fb := make([]complex128, n)
+	for i, sample := range a {
+		fa[i] = complex(sample, 0)
+	}
+	for i, sample := range b {
+		fb[i] = complex(sample, 0)
+	}
+	fft(fa)
+	fft(fb)
+	for k := range fa {
+		fa[k] = cmplx.Conj(fa[k]) * fb[k]
+	}
+	ifft(fa)
+	correlation := make([]float64, n)
+	for i := range correlation {
+		correlation[i] = real(fa[i])
+	}
+	return correlation
+}
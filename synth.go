@@ -7,6 +7,7 @@ import (
 	"image/color"
 	"io"
 	"math"
+	"sort"
 )
 
 // Constants for waveform types
@@ -20,6 +21,25 @@ const (
 	WaveBrownNoise
 )
 
+// Constants for the click sources of the kick attack
+const (
+	ClickNone = iota
+	ClickNoise
+	ClickSquare
+	ClickSine
+)
+
+// Constants for the drive modes, which is the character of the distortion in the drive stage. DriveDefault
+// keeps the drive stage of each generator, which is soft clipping for the kicks and hard clipping for the rest.
+// With the other modes, every generator drives the samples with a gain of 1+Drive, so that a Drive of 0 leaves
+// the samples unchanged, and the same Drive gives the same amount of distortion for all sound types.
+const (
+	DriveDefault = iota
+	DriveSoft
+	DriveHard
+	DriveTanh
+)
+
 // Settings holds the configuration for generating a sound
 type Settings struct {
 	SoundType                  SoundType
@@ -43,10 +63,13 @@ type Settings struct {
 	PitchDecay                 float64
 	NumOscillators             int
 	OscillatorLevels           []float64
+	OscillatorWaveforms        []int
+	OscillatorPans             []float64
 	SaturatorAmount            float64
 	FilterBands                []float64
 	FadeDuration               float64
 	SmoothFrequencyTransitions bool
+	FrequencySmoothing         float64
 	AttackCurve                FadeCurve
 	DecayCurve                 FadeCurve
 	ReleaseCurve               FadeCurve
@@ -55,6 +78,48 @@ type Settings struct {
 	DelayAmount                float64
 	DelayTime                  float64
 	DelayFeedback              float64
+	HatTightness               float64
+	ThumpFreq                  float64
+	ThumpGainDB                float64
+	SurroundAngle              float64
+	AutoTrim                   bool
+	UseExponentialDecay        bool
+	NoiseEnvelope              *NoiseEnvelope
+	StartOffset                float64
+	NoLimiter                  bool
+	FastMath                   bool
+	SyncOscillators            bool
+	CymbalReverbTail           float64
+	DecayStage2Sec             float64
+	DecayStage2Level           float64
+	PitchDrift                 float64
+	Seed                       int64
+	ClapDrift                  float64
+	ClickSource                int
+	RetroMode                  bool
+	IncludeReleaseTail         bool
+	FilterFMAmount             float64
+	SoftStart                  bool
+	UseSeed                    bool
+	Wavetable                  *MorphingWavetable
+	WavetablePosition          float64
+	WavetableMorphRate         float64
+	OutputGain                 float64
+	PitchRandomCents           float64
+	AlignTransients            bool
+	FileNameTemplate           string
+	BPM                        float64
+	DriveMode                  int
+	hits                       int64 // the number of tom and percussion hits so far, for PitchRandomCents
+}
+
+// NoiseEnvelope is a separate ADSR envelope for the noise component of the snare and clap,
+// which makes it possible to let the noise ring out longer than the tonal body
+type NoiseEnvelope struct {
+	Attack  float64
+	Decay   float64
+	Sustain float64
+	Release float64
 }
 
 // FadeCurve defines a type for fade curve functions
@@ -235,6 +300,54 @@ func RMSMixing(samples ...[]float64) ([]float64, error) {
 	return combined, nil
 }
 
+// MixInto adds the mono samples in src to the interleaved samples in dst, starting at the frame offsetFrames,
+// scaled by gain. For stereo, the sound is panned with a constant power pan law, where pan goes from -1 (left)
+// to 1 (right). With more than two channels, the pan applies to the first two, and the rest get the sound at
+// the given gain. dst is extended with silence if needed, so the returned slice should be used, like for append.
+func MixInto(dst []float64, src []float64, offsetFrames, channels int, gain, pan float64) []float64 {
+	if channels <= 0 || offsetFrames < 0 {
+		return dst
+	}
+	if end := (offsetFrames + len(src)) * channels; end > len(dst) {
+		dst = append(dst, make([]float64, end-len(dst))...)
+	}
+	gains := make([]float64, channels)
+	for c := range gains {
+		gains[c] = gain
+	}
+	if channels >= 2 {
+		pan = math.Max(-1, math.Min(1, pan))
+		gains[0] = gain * math.Cos((pan+1)*math.Pi/4)
+		gains[1] = gain * math.Cos((1-pan)*math.Pi/4)
+	}
+	for i, sample := range src {
+		frame := (offsetFrames + i) * channels
+		for c, g := range gains {
+			dst[frame+c] += sample * g
+		}
+	}
+	return dst
+}
+
+// DefaultDownmixGain is the gain (-3 dB) that is applied to each channel when downmixing stereo to mono
+const DefaultDownmixGain = math.Sqrt2 / 2
+
+// DownmixToMono combines the left and right channels into a single channel, scaling each channel by its gain.
+// Use DefaultDownmixGain for both gains to avoid clipping when the channels are summed.
+// If the channels differ in length, the shorter one is treated as if it was padded with silence.
+func DownmixToMono(left, right []float64, leftGain, rightGain float64) []float64 {
+	mono := make([]float64, max(len(left), len(right)))
+	for i := range mono {
+		if i < len(left) {
+			mono[i] += left[i] * leftGain
+		}
+		if i < len(right) {
+			mono[i] += right[i] * rightGain
+		}
+	}
+	return mono
+}
+
 // AnalyzeHighestFrequency estimates the highest frequency in the audio signal
 func AnalyzeHighestFrequency(samples []float64, sampleRate int) float64 {
 	zeroCrossings := 0
@@ -274,6 +387,57 @@ func NormalizeSamples(samples []float64, targetPeak float64) []float64 {
 	return normalizedSamples
 }
 
+// NormalizePercentile scales the samples so that the given percentile (0 to 100) of the absolute amplitudes
+// matches the target peak, instead of the highest amplitude. With a high percentile, like 99, a lone spike
+// can not keep the rest of the signal from being brought up to level. The samples above the target are
+// clamped to the [-1, 1] range after scaling, just like for NormalizeSamples.
+func NormalizePercentile(samples []float64, percentile float64, targetPeak float64) []float64 {
+	if len(samples) == 0 {
+		return samples
+	}
+	amplitudes := make([]float64, len(samples))
+	for i, sample := range samples {
+		amplitudes[i] = math.Abs(sample)
+	}
+	sort.Float64s(amplitudes)
+	index := int(math.Round(math.Max(0, math.Min(percentile, 100)) / 100 * float64(len(amplitudes)-1)))
+	level := amplitudes[index]
+	if level == 0 {
+		return samples
+	}
+	normalizedSamples := make([]float64, len(samples))
+	for i, sample := range samples {
+		normalizedSamples[i] = math.Max(-1, math.Min(1, sample*targetPeak/level))
+	}
+	return normalizedSamples
+}
+
+// DBToLinear converts a gain in dB to a linear multiplier, where 0 dB is 1.0 and +6 dB is about 2.0
+func DBToLinear(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// LinearToDB converts a linear multiplier to a gain in dB. A multiplier of 0 gives negative infinity.
+func LinearToDB(x float64) float64 {
+	return 20 * math.Log10(math.Abs(x))
+}
+
+// ApplyGainDB returns a copy of the samples with the given gain in dB applied
+func ApplyGainDB(samples []float64, db float64) []float64 {
+	gain := DBToLinear(db)
+	amplified := make([]float64, len(samples))
+	for i, sample := range samples {
+		amplified[i] = sample * gain
+	}
+	return amplified
+}
+
+// NormalizeToDBFS scales the samples so the peak amplitude matches the given level in dBFS,
+// where 0 dBFS is full scale and -1 dBFS is a peak amplitude of about 0.891
+func NormalizeToDBFS(samples []float64, dbfs float64) []float64 {
+	return NormalizeSamples(samples, DBToLinear(dbfs))
+}
+
 // FindPeakAmplitude returns the maximum absolute amplitude in the sample set
 func FindPeakAmplitude(samples []float64) float64 {
 	maxAmplitude := float64(0)
@@ -285,6 +449,151 @@ func FindPeakAmplitude(samples []float64) float64 {
 	return maxAmplitude
 }
 
+// WaveformStats returns the peak amplitude, the RMS level, the crest factor (peak divided by RMS)
+// and the DC offset (the mean) of the samples, computed in a single pass
+func WaveformStats(samples []float64) (peak, rms, crestFactor, dcOffset float64) {
+	if len(samples) == 0 {
+		return 0, 0, 0, 0
+	}
+	var sum, sumSquares float64
+	for _, sample := range samples {
+		if abs := math.Abs(sample); abs > peak {
+			peak = abs
+		}
+		sum += sample
+		sumSquares += sample * sample
+	}
+	rms = math.Sqrt(sumSquares / float64(len(samples)))
+	dcOffset = sum / float64(len(samples))
+	if rms > 0 {
+		crestFactor = peak / rms
+	}
+	return peak, rms, crestFactor, dcOffset
+}
+
+// MatchLoudness scales the samples so that their RMS level matches the RMS level of the reference
+func MatchLoudness(reference, samples []float64) []float64 {
+	_, referenceRMS, _, _ := WaveformStats(reference)
+	_, rms, _, _ := WaveformStats(samples)
+	matched := make([]float64, len(samples))
+	if rms == 0 {
+		copy(matched, samples)
+		return matched
+	}
+	for i, sample := range samples {
+		matched[i] = sample * referenceRMS / rms
+	}
+	return matched
+}
+
+// autoLevelMaxGain is the highest gain that AutoLevel applies, so that silence and noise are not boosted (+20 dB)
+const autoLevelMaxGain = 10.0
+
+// AutoLevel is a slow leveler that keeps the RMS level of the samples close to targetRMS over time.
+// The level is followed by a one-pole filter on the squared samples, with windowSec as the time constant,
+// which is run both forwards and backwards, so that the gain changes ahead of level changes instead of
+// lagging behind. Since the gain changes slowly, short transients keep their punch.
+func AutoLevel(samples []float64, targetRMS, windowSec float64, sampleRate int) []float64 {
+	leveled := make([]float64, len(samples))
+	if len(samples) == 0 {
+		return leveled
+	}
+	coeff := math.Exp(-1.0 / (math.Max(windowSec, 1e-6) * float64(sampleRate)))
+	forward := make([]float64, len(samples))
+	level := 0.0
+	for i, sample := range samples {
+		level = coeff*level + (1-coeff)*sample*sample
+		forward[i] = level
+	}
+	level = 0.0
+	for i := len(samples) - 1; i >= 0; i-- {
+		level = coeff*level + (1-coeff)*samples[i]*samples[i]
+		rms := math.Sqrt((forward[i] + level) / 2)
+		gain := autoLevelMaxGain
+		if rms > 0 {
+			gain = math.Min(targetRMS/rms, autoLevelMaxGain)
+		}
+		leveled[i] = samples[i] * gain
+	}
+	return leveled
+}
+
+// SilenceRegions returns the start and end times, in seconds, of the regions where the samples are below the
+// given threshold in dBFS. The level is measured as the RMS of 10 ms windows, so the zero crossings of a
+// signal are not reported as silence.
+func SilenceRegions(samples []float64, thresholdDB float64, sampleRate int) [][2]float64 {
+	threshold := DBToLinear(thresholdDB)
+	windowSize := max(sampleRate/100, 1)
+	var regions [][2]float64
+	silentFrom := -1
+	for start := 0; start < len(samples); start += windowSize {
+		end := min(start+windowSize, len(samples))
+		_, rms, _, _ := WaveformStats(samples[start:end])
+		if rms < threshold {
+			if silentFrom < 0 {
+				silentFrom = start
+			}
+		} else if silentFrom >= 0 {
+			regions = append(regions, [2]float64{float64(silentFrom) / float64(sampleRate), float64(start) / float64(sampleRate)})
+			silentFrom = -1
+		}
+	}
+	if silentFrom >= 0 {
+		regions = append(regions, [2]float64{float64(silentFrom) / float64(sampleRate), float64(len(samples)) / float64(sampleRate)})
+	}
+	return regions
+}
+
+// AlignByCorrelation finds the lag, within ±maxLagSamples, where the cross-correlation between a and b is at
+// its maximum, and returns that lag together with b shifted by it so that it lines up with a. A positive lag
+// means that b comes later than a. The returned samples have the same length as b, padded with zeros.
+func AlignByCorrelation(a, b []float64, maxLagSamples int) (lag int, aligned []float64) {
+	bestCorrelation := math.Inf(-1)
+	for l := -maxLagSamples; l <= maxLagSamples; l++ {
+		correlation := 0.0
+		for i, sample := range a {
+			if j := i + l; j >= 0 && j < len(b) {
+				correlation += sample * b[j]
+			}
+		}
+		if correlation > bestCorrelation {
+			bestCorrelation = correlation
+			lag = l
+		}
+	}
+	return lag, shiftByLag(b, lag)
+}
+
+// shiftByLag returns the samples shifted back in time by lag samples, or forward in time for a negative lag,
+// with the same length as the given samples, padded with zeros
+func shiftByLag(samples []float64, lag int) []float64 {
+	shifted := make([]float64, len(samples))
+	for i := range shifted {
+		if j := i + lag; j >= 0 && j < len(samples) {
+			shifted[i] = samples[j]
+		}
+	}
+	return shifted
+}
+
+// AlignDelay finds the delay of the delayed samples compared to the reference, for instance the group delay
+// of a filter, and returns it together with the delayed samples shifted back in time to compensate for it.
+// Delays of up to half the length of the shortest signal are searched for. This works like AlignByCorrelation,
+// but the cross-correlation is computed with an FFT, so that long signals can be aligned quickly.
+func AlignDelay(reference, delayed []float64) (offset int, aligned []float64) {
+	maxLag := min(len(reference), len(delayed)) / 2
+	correlation := crossCorrelation(reference, delayed)
+	bestCorrelation := math.Inf(-1)
+	for l := -maxLag; l <= maxLag; l++ {
+		// Negative lags wrap around to the end
+		if c := correlation[(l+len(correlation))%len(correlation)]; c > bestCorrelation {
+			bestCorrelation = c
+			offset = l
+		}
+	}
+	return offset, shiftByLag(delayed, offset)
+}
+
 // PadSamples pads the shorter waveform with zeros to make both waveforms the same length.
 func PadSamples(wave1, wave2 []float64) ([]float64, []float64) {
 	length1 := len(wave1)
@@ -310,9 +619,23 @@ func PadSamples(wave1, wave2 []float64) ([]float64, []float64) {
 func CopySettings(cfg *Settings) *Settings {
 	newCfg := *cfg
 	newCfg.OscillatorLevels = append([]float64(nil), cfg.OscillatorLevels...) // Deep copy the slice
+	newCfg.OscillatorWaveforms = append([]int(nil), cfg.OscillatorWaveforms...)
+	newCfg.OscillatorPans = append([]float64(nil), cfg.OscillatorPans...)
+	if cfg.NoiseEnvelope != nil {
+		noiseEnvelope := *cfg.NoiseEnvelope
+		newCfg.NoiseEnvelope = &noiseEnvelope
+	}
 	return &newCfg
 }
 
+// WithSeed seeds the noise and random variations with the given seed, for a "classic analog" preset
+// that always produces the exact same sound. The settings are returned, for convenience.
+func (cfg *Settings) WithSeed(seed int64) *Settings {
+	cfg.Seed = seed
+	cfg.UseSeed = true
+	return cfg
+}
+
 // Color returns a color that represents the current kick config
 func (cfg *Settings) Color() color.RGBA {
 	hasher := sha1.New()
@@ -443,3 +766,102 @@ func Resample(waveform []float64, originalSampleRate, targetSampleRate int) []fl
 	}
 	return resampledWaveform
 }
+
+// ResampleCubic resamples the waveform using cubic (Catmull-Rom) interpolation, which is a cheap middle ground
+// between the linear interpolation of Resample and the windowed-sinc interpolation of ResampleSinc
+func ResampleCubic(waveform []float64, originalSampleRate, targetSampleRate int) []float64 {
+	if originalSampleRate == targetSampleRate || originalSampleRate <= 0 || targetSampleRate <= 0 {
+		return waveform
+	}
+	at := func(i int) float64 {
+		return waveform[min(max(i, 0), len(waveform)-1)]
+	}
+	resampleFactor := float64(targetSampleRate) / float64(originalSampleRate)
+	newLength := int(float64(len(waveform)) * resampleFactor)
+	resampledWaveform := make([]float64, newLength)
+	for i := 0; i < newLength; i++ {
+		oldPos := float64(i) / resampleFactor
+		index := int(oldPos)
+		x := oldPos - float64(index)
+		p0, p1, p2, p3 := at(index-1), at(index), at(index+1), at(index+2)
+		resampledWaveform[i] = p1 + 0.5*x*(p2-p0+x*(2*p0-5*p1+4*p2-p3+x*(3*(p1-p2)+p3-p0)))
+	}
+	return resampledWaveform
+}
+
+// ResampleQuality is the interpolation that is used by ResampleWithQuality
+type ResampleQuality int
+
+// Constants for resampling qualities, from the fastest to the best
+const (
+	ResampleQualityLinear ResampleQuality = iota
+	ResampleQualityCubic
+	ResampleQualitySinc
+)
+
+// resampleSincWindowSize is the window size that is used for ResampleQualitySinc
+const resampleSincWindowSize = 32
+
+// ParseResampleQuality returns the resampling quality for the given name, which is "linear", "cubic" or "sinc"
+func ParseResampleQuality(name string) (ResampleQuality, error) {
+	switch name {
+	case "linear":
+		return ResampleQualityLinear, nil
+	case "cubic":
+		return ResampleQualityCubic, nil
+	case "sinc":
+		return ResampleQualitySinc, nil
+	default:
+		return ResampleQualityLinear, fmt.Errorf("unknown resampling quality: %s", name)
+	}
+}
+
+// ResampleWithQuality resamples the waveform with the given quality, which picks the tradeoff between speed
+// and accuracy: linear interpolation, cubic interpolation, or windowed-sinc interpolation
+func ResampleWithQuality(waveform []float64, originalSampleRate, targetSampleRate int, quality ResampleQuality) []float64 {
+	switch quality {
+	case ResampleQualityCubic:
+		return ResampleCubic(waveform, originalSampleRate, targetSampleRate)
+	case ResampleQualitySinc:
+		return ResampleSinc(waveform, originalSampleRate, targetSampleRate, resampleSincWindowSize)
+	default:
+		return Resample(waveform, originalSampleRate, targetSampleRate)
+	}
+}
+
+// ResampleSinc resamples the waveform using windowed-sinc interpolation, which is slower than Resample,
+// but preserves the high frequencies and suppresses aliasing. windowSize is the number of neighbouring
+// samples that are used on each side of every interpolated sample, where 16 to 64 is typical.
+func ResampleSinc(waveform []float64, originalSampleRate, targetSampleRate, windowSize int) []float64 {
+	if originalSampleRate == targetSampleRate || originalSampleRate <= 0 || targetSampleRate <= 0 {
+		return waveform
+	}
+	if windowSize < 1 {
+		windowSize = 1
+	}
+	resampleFactor := float64(targetSampleRate) / float64(originalSampleRate)
+	// When downsampling, the cutoff is lowered to the new Nyquist frequency, and the kernel is widened to match
+	cutoff := math.Min(1, resampleFactor)
+	halfWidth := float64(windowSize) / cutoff
+	newLength := int(float64(len(waveform)) * resampleFactor)
+	resampledWaveform := make([]float64, newLength)
+	for i := 0; i < newLength; i++ {
+		oldPos := float64(i) / resampleFactor
+		first := max(int(math.Ceil(oldPos-halfWidth)), 0)
+		last := min(int(math.Floor(oldPos+halfWidth)), len(waveform)-1)
+		sum := 0.0
+		for j := first; j <= last; j++ {
+			x := float64(j) - oldPos
+			// Blackman window over [-halfWidth, halfWidth]
+			phase := math.Pi * (x/halfWidth + 1)
+			window := 0.42 - 0.5*math.Cos(phase) + 0.08*math.Cos(2*phase)
+			sinc := 1.0
+			if x != 0 {
+				sinc = math.Sin(math.Pi*cutoff*x) / (math.Pi * cutoff * x)
+			}
+			sum += waveform[j] * cutoff * sinc * window
+		}
+		resampledWaveform[i] = sum
+	}
+	return resampledWaveform
+}
@@ -1,10 +1,18 @@
 package synth
 
 import (
+	"bytes"
 	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/go-audio/wav"
 	"github.com/xyproto/playsample"
 )
 
@@ -882,3 +890,3516 @@ func TestApplyFadeOutQuadratic(t *testing.T) {
 		}
 	}
 }
+
+// energyHalfLife returns the time in seconds at which half of the total signal energy has been reached
+func energyHalfLife(samples []float64, sampleRate int) float64 {
+	total := 0.0
+	for _, s := range samples {
+		total += s * s
+	}
+	acc := 0.0
+	for i, s := range samples {
+		acc += s * s
+		if acc >= total/2 {
+			return float64(i) / float64(sampleRate)
+		}
+	}
+	return float64(len(samples)) / float64(sampleRate)
+}
+
+func TestHatTightness(t *testing.T) {
+	cfg, err := NewSettings(nil, 10000.0, 7000.0, 0.3, 44100, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.SoundType = OpenHH
+	cfg.NoiseAmount = 1.0
+	cfg.Attack = 0.001
+	cfg.Decay = 0.2
+	cfg.Sustain = 0.5
+	cfg.Release = 0.05
+	cfg.Drive = 1.0 // unity gain
+
+	previous := math.Inf(1)
+	for _, tightness := range []float64{0.0, 0.2, 0.4, 0.6, 0.8, 1.0} {
+		cfg.HatTightness = tightness
+		samples, err := cfg.GenerateOpenHH()
+		if err != nil {
+			t.Fatalf("GenerateOpenHH failed: %v", err)
+		}
+		halfLife := energyHalfLife(samples, cfg.SampleRate)
+		if halfLife >= previous {
+			t.Errorf("Expected tightness %.1f to shorten the energy half-life below %f, got %f", tightness, previous, halfLife)
+		}
+		previous = halfLife
+	}
+}
+
+func TestPatternSetPolyStep(t *testing.T) {
+	pattern, err := NewPattern(120, 16)
+	if err != nil {
+		t.Fatalf("NewPattern failed: %v", err)
+	}
+	for step := 0; step < 4; step++ {
+		if err := pattern.SetPolyStep("kick", 4, step, 1.0); err != nil {
+			t.Fatalf("SetPolyStep failed: %v", err)
+		}
+	}
+	for step := 0; step < 6; step++ {
+		if err := pattern.SetPolyStep("hihat", 6, step, 0.7); err != nil {
+			t.Fatalf("SetPolyStep failed: %v", err)
+		}
+	}
+	if err := pattern.SetPolyStep("hihat", 6, 6, 0.7); err == nil {
+		t.Error("Expected an error for a step outside of the grid")
+	}
+
+	sampleRate := 44100
+	barSamples := 2 * sampleRate // one bar at 120 BPM is 2 seconds
+	kicks := pattern.Onsets("kick", sampleRate)
+	hats := pattern.Onsets("hihat", sampleRate)
+	if len(kicks) != 4 || len(hats) != 6 {
+		t.Fatalf("Expected 4 kick and 6 hi-hat onsets, got %d and %d", len(kicks), len(hats))
+	}
+	for i, onset := range kicks {
+		if expected := i * barSamples / 4; onset != expected {
+			t.Errorf("Expected kick onset %d at %d, got %d", i, expected, onset)
+		}
+	}
+	for i, onset := range hats {
+		if expected := i * barSamples / 6; onset != expected {
+			t.Errorf("Expected hi-hat onset %d at %d, got %d", i, expected, onset)
+		}
+	}
+}
+
+func TestSaveAndLoadWavWithLoop(t *testing.T) {
+	samples := createSineWave(440.0, 4410, 44100)
+	filename := "test_loop_output.wav"
+	defer os.Remove(filename)
+
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("Failed to create WAV file: %v", err)
+	}
+	loop := LoopRegion{Start: 1000, End: 3999}
+	if err := SaveToWavWithLoop(file, samples, 44100, 16, 1, loop); err != nil {
+		t.Fatalf("SaveToWavWithLoop failed: %v", err)
+	}
+	file.Close()
+
+	loaded, sampleRate, loadedLoop, err := LoadWavWithLoop(filename)
+	if err != nil {
+		t.Fatalf("LoadWavWithLoop failed: %v", err)
+	}
+	if sampleRate != 44100 {
+		t.Errorf("Expected sample rate of 44100, got %d", sampleRate)
+	}
+	if len(loaded) != len(samples) {
+		t.Errorf("Expected %d samples, got %d", len(samples), len(loaded))
+	}
+	if loadedLoop == nil {
+		t.Fatal("Expected a loop region, got nil")
+	}
+	if *loadedLoop != loop {
+		t.Errorf("Expected loop region %v, got %v", loop, *loadedLoop)
+	}
+}
+
+func TestLoadAndRenderMIDI(t *testing.T) {
+	// A format 0 MIDI file with 480 ticks per quarter note at 120 BPM (0.5 seconds per quarter note),
+	// playing note 60 at 0s, note 64 at 0.5s and note 67 at 1.0s, each lasting an eighth note.
+	track := []byte{
+		0x00, 0xff, 0x51, 0x03, 0x07, 0xa1, 0x20, // tempo: 500000 microseconds per quarter note
+		0x00, 0x90, 60, 100,
+		0x81, 0x70, 0x80, 60, 0, // delta 240
+		0x81, 0x70, 0x90, 64, 100,
+		0x81, 0x70, 64, 0, // running status, note-on with velocity 0
+		0x81, 0x70, 0x90, 67, 127,
+		0x81, 0x70, 0x80, 67, 0,
+		0x00, 0xff, 0x2f, 0x00,
+	}
+	data := []byte{'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 0, 0, 1, 0x01, 0xe0}
+	data = append(data, 'M', 'T', 'r', 'k', 0, 0, 0, byte(len(track)))
+	data = append(data, track...)
+	filename := "test_input.mid"
+	defer os.Remove(filename)
+	if err := os.WriteFile(filename, data, 0o644); err != nil {
+		t.Fatalf("Failed to write MIDI file: %v", err)
+	}
+
+	events, err := LoadMIDI(filename)
+	if err != nil {
+		t.Fatalf("LoadMIDI failed: %v", err)
+	}
+	expectedNotes := []int{60, 64, 67}
+	expectedTimes := []float64{0.0, 0.5, 1.0}
+	if len(events) != len(expectedNotes) {
+		t.Fatalf("Expected %d notes, got %d", len(expectedNotes), len(events))
+	}
+	for i, e := range events {
+		if e.Note != expectedNotes[i] || math.Abs(e.Time-expectedTimes[i]) > 1e-9 || math.Abs(e.Duration-0.25) > 1e-9 {
+			t.Errorf("Expected note %d at %.2fs lasting 0.25s, got note %d at %.4fs lasting %.4fs", expectedNotes[i], expectedTimes[i], e.Note, e.Time, e.Duration)
+		}
+	}
+
+	sampleRate := 44100
+	instrument := func(note int, velocity float64) *Settings {
+		freq := MIDINoteToFrequency(note)
+		cfg, _ := NewSettings(nil, freq, freq, 0.1, sampleRate, 16, 1)
+		cfg.SoundType = Percussion
+		cfg.Drive = 1.0
+		return cfg
+	}
+	rendered, err := RenderMIDI(events, instrument, sampleRate, 16, 1)
+	if err != nil {
+		t.Fatalf("RenderMIDI failed: %v", err)
+	}
+	for i, start := range expectedTimes {
+		from := int(start * float64(sampleRate))
+		if peak := FindPeakAmplitude(rendered[from : from+sampleRate/20]); peak < 0.1 {
+			t.Errorf("Expected note %d to be audible at %.2fs, got peak %f", i, start, peak)
+		}
+		if i > 0 {
+			if peak := FindPeakAmplitude(rendered[from-sampleRate/4 : from]); peak != 0 {
+				t.Errorf("Expected silence before note %d, got peak %f", i, peak)
+			}
+		}
+	}
+}
+
+func TestSaveMIDI(t *testing.T) {
+	pattern, err := NewPattern(100, 16)
+	if err != nil {
+		t.Fatalf("NewPattern failed: %v", err)
+	}
+	for _, step := range []int{0, 4, 8, 12} {
+		pattern.SetStep("kick", step, 1.0)
+	}
+	for step := 0; step < 6; step++ {
+		pattern.SetPolyStep("hihat", 6, step, 0.5)
+	}
+	filename := "test_pattern.mid"
+	defer os.Remove(filename)
+	if err := SaveMIDI(filename, pattern); err != nil {
+		t.Fatalf("SaveMIDI failed: %v", err)
+	}
+
+	events, err := LoadMIDI(filename)
+	if err != nil {
+		t.Fatalf("LoadMIDI failed: %v", err)
+	}
+	sampleRate := 48000
+	expected := map[int][]int{36: pattern.Onsets("kick", sampleRate), 42: pattern.Onsets("hihat", sampleRate)}
+	found := map[int][]int{}
+	for _, e := range events {
+		found[e.Note] = append(found[e.Note], int(math.Round(e.Time*float64(sampleRate))))
+	}
+	for note, onsets := range expected {
+		if len(found[note]) != len(onsets) {
+			t.Fatalf("Expected %d onsets for note %d, got %d", len(onsets), note, len(found[note]))
+		}
+		for i := range onsets {
+			if found[note][i] != onsets[i] {
+				t.Errorf("Expected note %d onset %d at sample %d, got %d", note, i, onsets[i], found[note][i])
+			}
+		}
+	}
+	if err := SaveMIDI(filename, &Pattern{BPM: 120, Steps: []PatternStep{{Instrument: "cowbell", StepsPerBar: 4, Velocity: 1}}}); err == nil {
+		t.Error("Expected an error for an instrument without a MIDI note")
+	}
+	if err := SaveMIDI(filename, &Pattern{BPM: 120, Steps: []PatternStep{{Instrument: "kick", Velocity: 1}}}); err == nil {
+		t.Error("Expected an error for a step with no steps per bar")
+	}
+	if err := SaveMIDI(filename, nil); err == nil {
+		t.Error("Expected an error for a nil pattern")
+	}
+}
+
+// magnitudeSpectrum returns the DFT magnitudes of the samples, for the bins from 0 up to the Nyquist frequency
+func magnitudeSpectrum(samples []float64) []float64 {
+	n := len(samples)
+	magnitudes := make([]float64, n/2+1)
+	for k := range magnitudes {
+		var re, im float64
+		for i, sample := range samples {
+			angle := 2 * math.Pi * float64(k*i%n) / float64(n)
+			re += sample * math.Cos(angle)
+			im -= sample * math.Sin(angle)
+		}
+		magnitudes[k] = math.Sqrt(re*re + im*im)
+	}
+	return magnitudes
+}
+
+// spectralCentroid returns the magnitude weighted mean frequency of the samples
+func spectralCentroid(samples []float64, sampleRate int) float64 {
+	magnitudes := magnitudeSpectrum(samples)
+	var weighted, total float64
+	for k, m := range magnitudes {
+		weighted += float64(k) * float64(sampleRate) / float64(len(samples)) * m
+		total += m
+	}
+	if total == 0 {
+		return 0
+	}
+	return weighted / total
+}
+
+func TestEnvelopeFilter(t *testing.T) {
+	sampleRate := 44100
+	loud := GenerateWhiteNoise(8192, 1.0)
+	quiet := make([]float64, len(loud))
+	for i, sample := range loud {
+		quiet[i] = sample * 0.05
+	}
+	loudFiltered := EnvelopeFilter(loud, 300.0, 1.0, sampleRate)
+	quietFiltered := EnvelopeFilter(quiet, 300.0, 1.0, sampleRate)
+	if len(loudFiltered) != len(loud) {
+		t.Fatalf("Expected filtered length of %d, got %d", len(loud), len(loudFiltered))
+	}
+	// Skip the first part, where the envelope follower is still rising
+	loudCentroid := spectralCentroid(loudFiltered[4096:], sampleRate)
+	quietCentroid := spectralCentroid(quietFiltered[4096:], sampleRate)
+	if loudCentroid <= quietCentroid*1.5 {
+		t.Errorf("Expected the loud input to open the filter, got centroids %.1f Hz (loud) and %.1f Hz (quiet)", loudCentroid, quietCentroid)
+	}
+}
+
+func TestSmoothFrequencyTransitions(t *testing.T) {
+	cfg, err := NewSettings(nil, 200.0, 40.0, 0.5, 44100, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	maxStep := func(frequencies []float64) float64 {
+		largest := 0.0
+		for i := 1; i < len(frequencies); i++ {
+			largest = math.Max(largest, math.Abs(frequencies[i]-frequencies[i-1]))
+		}
+		return largest
+	}
+	cfg.SmoothFrequencyTransitions = false
+	numSamples := int(cfg.Duration * float64(cfg.SampleRate))
+	unsmoothed := maxStep(cfg.frequencyTrajectory(numSamples))
+	cfg.SmoothFrequencyTransitions = true
+	cfg.FrequencySmoothing = 0.01
+	smoothed := maxStep(cfg.frequencyTrajectory(numSamples))
+	if smoothed >= unsmoothed {
+		t.Errorf("Expected smoothing to reduce the largest frequency step, got %f (smoothed) and %f (unsmoothed)", smoothed, unsmoothed)
+	}
+
+	for _, generate := range []func() ([]float64, error){cfg.GenerateKick, cfg.GenerateSnare, cfg.GenerateTom} {
+		samples, err := generate()
+		if err != nil {
+			t.Fatalf("Generating with smoothing failed: %v", err)
+		}
+		if len(samples) != numSamples {
+			t.Errorf("Expected %d samples, got %d", numSamples, len(samples))
+		}
+	}
+}
+
+func TestEnvelopePoints(t *testing.T) {
+	cfg := &Settings{Duration: 1.0, Attack: 0.1, Decay: 0.2, Sustain: 0.5, Release: 0.3}
+	points := cfg.EnvelopePoints(101)
+	if len(points) != 101 {
+		t.Fatalf("Expected 101 envelope points, got %d", len(points))
+	}
+	if points[0] != 0 {
+		t.Errorf("Expected the envelope to start at 0, got %f", points[0])
+	}
+	if math.Abs(points[10]-1.0) > 1e-9 {
+		t.Errorf("Expected the envelope to peak at 1 after the attack, got %f", points[10])
+	}
+	for i, p := range points {
+		if p > 1.0+1e-9 {
+			t.Errorf("Expected envelope point %d to be at most 1, got %f", i, p)
+		}
+	}
+	if last := points[len(points)-1]; math.Abs(last) > 1e-6 {
+		t.Errorf("Expected the envelope to end near 0, got %f", last)
+	}
+}
+
+func TestSaveToWavChecked(t *testing.T) {
+	samples := []float64{0.5, 1.5, -0.2, -1.2, 1.0, -1.0, 2.0, 0.0}
+	filename := "test_checked_output.wav"
+	defer os.Remove(filename)
+
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("Failed to create WAV file: %v", err)
+	}
+	defer file.Close()
+
+	clamped, err := SaveToWavChecked(file, samples, 44100, 16, 1)
+	if err != nil {
+		t.Fatalf("SaveToWavChecked failed: %v", err)
+	}
+	if clamped != 3 {
+		t.Errorf("Expected 3 clamped samples, got %d", clamped)
+	}
+}
+
+func TestDownmixToMono(t *testing.T) {
+	channel := createSineWave(440.0, 1000, 44100)
+	mono := DownmixToMono(channel, channel, DefaultDownmixGain, DefaultDownmixGain)
+	if len(mono) != len(channel) {
+		t.Fatalf("Expected downmix length of %d, got %d", len(channel), len(mono))
+	}
+	for i, sample := range mono {
+		if expected := channel[i] * math.Sqrt2; math.Abs(sample-expected) > 1e-9 {
+			t.Errorf("Expected downmixed sample %d to be %f, got %f", i, expected, sample)
+			break
+		}
+	}
+	if gainDB := 20 * math.Log10(DefaultDownmixGain); math.Abs(gainDB+3.0103) > 1e-3 {
+		t.Errorf("Expected the default downmix gain to be -3 dB, got %f dB", gainDB)
+	}
+}
+
+// bandEnergy returns the spectral energy of the samples between the low and high frequencies
+func bandEnergy(samples []float64, low, high float64, sampleRate int) float64 {
+	energy := 0.0
+	for k, m := range magnitudeSpectrum(samples) {
+		if freq := float64(k) * float64(sampleRate) / float64(len(samples)); freq >= low && freq <= high {
+			energy += m * m
+		}
+	}
+	return energy
+}
+
+func TestGenerateKickThump(t *testing.T) {
+	cfg, err := NewSettings(nil, 150.0, 40.0, 0.5, 4000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.Drive = 0
+	cfg.OscillatorLevels = []float64{0.3}
+	plain, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick failed: %v", err)
+	}
+	cfg.ThumpFreq = 80
+	cfg.ThumpGainDB = 9
+	boosted, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick with thump failed: %v", err)
+	}
+	plainEnergy := bandEnergy(plain, 60, 100, cfg.SampleRate)
+	boostedEnergy := bandEnergy(boosted, 60, 100, cfg.SampleRate)
+	if boostedEnergy <= plainEnergy*2 {
+		t.Errorf("Expected the thump boost to increase the 60-100 Hz energy, got %f (boosted) and %f (plain)", boostedEnergy, plainEnergy)
+	}
+}
+
+// rootMeanSquare returns the RMS level of the samples
+func rootMeanSquare(samples []float64) float64 {
+	sum := 0.0
+	for _, s := range samples {
+		sum += s * s
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+// peakFrequency returns the frequency of the strongest bin in the spectrum of the samples
+func peakFrequency(samples []float64, sampleRate int) float64 {
+	magnitudes := magnitudeSpectrum(samples)
+	peak := 1
+	for k := 1; k < len(magnitudes); k++ {
+		if magnitudes[k] > magnitudes[peak] {
+			peak = k
+		}
+	}
+	return float64(peak) * float64(sampleRate) / float64(len(samples))
+}
+
+func TestGeneratePhysicalKick(t *testing.T) {
+	cfg, err := NewSettings(nil, 150.0, 50.0, 0.5, 4000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.Drive = 0
+	cfg.NoiseAmount = 0
+	samples, err := cfg.GeneratePhysicalKick()
+	if err != nil {
+		t.Fatalf("GeneratePhysicalKick failed: %v", err)
+	}
+	if len(samples) != 2000 {
+		t.Fatalf("Expected 2000 samples, got %d", len(samples))
+	}
+	// The resonance should stay at the fundamental, both early and late in the sound
+	early, late := samples[:500], samples[1000:1500]
+	if f := peakFrequency(early, cfg.SampleRate); math.Abs(f-50) > 10 {
+		t.Errorf("Expected an early resonance near 50 Hz, got %f Hz", f)
+	}
+	if f := peakFrequency(late, cfg.SampleRate); math.Abs(f-50) > 10 {
+		t.Errorf("Expected a late resonance near 50 Hz, got %f Hz", f)
+	}
+	if rmsEarly, rmsLate := rootMeanSquare(early), rootMeanSquare(late); rmsLate >= rmsEarly {
+		t.Errorf("Expected the resonance to decay, got RMS %f early and %f late", rmsEarly, rmsLate)
+	}
+	// The sine sweep of GenerateKick starts well above the fundamental
+	cfg.OscillatorLevels = []float64{1.0}
+	sweep, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick failed: %v", err)
+	}
+	if f := peakFrequency(sweep[:500], cfg.SampleRate); f < 80 {
+		t.Errorf("Expected the GenerateKick sweep to start above 80 Hz, got %f Hz", f)
+	}
+}
+
+func TestGenerateVariation(t *testing.T) {
+	cfg, err := NewSettings(nil, 120.0, 50.0, 0.3, 8000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.SoundType = Kick
+	cfg.Drive = 0
+	cfg.NoiseAmount = 0
+	original, err := cfg.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	a, err := cfg.GenerateVariation(1, 0.5)
+	if err != nil {
+		t.Fatalf("GenerateVariation failed: %v", err)
+	}
+	again, err := cfg.GenerateVariation(1, 0.5)
+	if err != nil {
+		t.Fatalf("GenerateVariation failed: %v", err)
+	}
+	b, err := cfg.GenerateVariation(2, 0.5)
+	if err != nil {
+		t.Fatalf("GenerateVariation failed: %v", err)
+	}
+	if len(a) != len(original) || len(b) != len(original) {
+		t.Fatalf("Expected variations of length %d, got %d and %d", len(original), len(a), len(b))
+	}
+	difference := func(x, y []float64) []float64 {
+		d := make([]float64, len(x))
+		for i := range x {
+			d[i] = x[i] - y[i]
+		}
+		return d
+	}
+	if rootMeanSquare(difference(a, again)) != 0 {
+		t.Error("Expected the same seed to give the same variation")
+	}
+	if rootMeanSquare(difference(a, b)) == 0 {
+		t.Error("Expected different seeds to give different variations")
+	}
+	// The variations should stay close to the original sound, in terms of loudness
+	for _, v := range [][]float64{a, b} {
+		if ratio := rootMeanSquare(v) / rootMeanSquare(original); ratio < 0.8 || ratio > 1.25 {
+			t.Errorf("Expected the variation RMS to be within 20%% of the original, got a ratio of %f", ratio)
+		}
+	}
+	if _, err := cfg.GenerateVariation(1, 2); err == nil {
+		t.Error("Expected an error for a variation amount above 1")
+	}
+}
+
+func TestWindow(t *testing.T) {
+	hann := Window(65, WindowHann)
+	if len(hann) != 65 {
+		t.Fatalf("Expected a window of length 65, got %d", len(hann))
+	}
+	if math.Abs(hann[0]) > 1e-12 || math.Abs(hann[64]) > 1e-12 {
+		t.Errorf("Expected the Hann window to be 0 at the endpoints, got %f and %f", hann[0], hann[64])
+	}
+	if math.Abs(hann[32]-1) > 1e-12 {
+		t.Errorf("Expected the Hann window to be 1 at the center, got %f", hann[32])
+	}
+	for _, kind := range []WindowKind{WindowRectangular, WindowHamming, WindowBlackman} {
+		window := Window(65, kind)
+		if math.Abs(window[32]-1) > 1e-9 {
+			t.Errorf("Expected window kind %d to be 1 at the center, got %f", kind, window[32])
+		}
+		if math.Abs(window[0]-window[64]) > 1e-9 {
+			t.Errorf("Expected window kind %d to be symmetric, got %f and %f", kind, window[0], window[64])
+		}
+	}
+	windowed := ApplyWindow([]float64{1, 1, 1, 1, 1}, Window(5, WindowHann))
+	expected := []float64{0, 0.5, 1, 0.5, 0}
+	for i := range expected {
+		if math.Abs(windowed[i]-expected[i]) > 1e-12 {
+			t.Errorf("Expected windowed sample %d to be %f, got %f", i, expected[i], windowed[i])
+		}
+	}
+}
+
+func TestImpulseTrain(t *testing.T) {
+	sampleRate := 4000
+	samples := ImpulseTrain(200, sampleRate, sampleRate)
+	if len(samples) != sampleRate {
+		t.Fatalf("Expected %d samples, got %d", sampleRate, len(samples))
+	}
+	if math.Abs(samples[0]-1) > 1e-9 {
+		t.Errorf("Expected the first impulse to peak at 1, got %f", samples[0])
+	}
+	// With one second of samples, each bin in the spectrum is 1 Hz wide
+	magnitudes := magnitudeSpectrum(samples)
+	for harmonic := 200; harmonic < sampleRate/2; harmonic += 200 {
+		if magnitudes[harmonic] < 100 {
+			t.Errorf("Expected a harmonic at %d Hz, got a magnitude of %f", harmonic, magnitudes[harmonic])
+		}
+	}
+	for k, m := range magnitudes {
+		if k%200 != 0 && m > 1e-6*magnitudes[200] {
+			t.Errorf("Expected negligible energy at %d Hz, got a magnitude of %f", k, m)
+			break
+		}
+	}
+	if magnitudes[sampleRate/2] > 1e-6*magnitudes[200] {
+		t.Errorf("Expected no energy at the Nyquist frequency, got a magnitude of %f", magnitudes[sampleRate/2])
+	}
+}
+
+func TestResampleSinc(t *testing.T) {
+	sine := func(freq float64, length, sampleRate int) []float64 {
+		samples := make([]float64, length)
+		for i := range samples {
+			samples[i] = math.Sin(2 * math.Pi * freq * float64(i) / float64(sampleRate))
+		}
+		return samples
+	}
+
+	// A 10 kHz tone is above the Nyquist frequency of 16 kHz, and should be removed instead of aliased
+	tone := sine(10000, 4800, 48000)
+	sincAliasing := rootMeanSquare(ResampleSinc(tone, 48000, 16000, 32)[200:1400])
+	linearAliasing := rootMeanSquare(Resample(tone, 48000, 16000)[200:1400])
+	if sincAliasing > 0.05 || sincAliasing >= linearAliasing {
+		t.Errorf("Expected less aliasing with ResampleSinc, got an RMS of %f (sinc) and %f (linear)", sincAliasing, linearAliasing)
+	}
+
+	// A 3 kHz tone that is upsampled from 8 kHz should stay close to an ideal 3 kHz tone
+	upsampledSinc := ResampleSinc(sine(3000, 800, 8000), 8000, 16000, 32)
+	upsampledLinear := Resample(sine(3000, 800, 8000), 8000, 16000)
+	ideal := sine(3000, 1600, 16000)
+	var sincError, linearError []float64
+	for i := 200; i < 1400; i++ {
+		sincError = append(sincError, upsampledSinc[i]-ideal[i])
+		linearError = append(linearError, upsampledLinear[i]-ideal[i])
+	}
+	if rootMeanSquare(sincError) > 0.01 || rootMeanSquare(sincError) >= rootMeanSquare(linearError) {
+		t.Errorf("Expected ResampleSinc to preserve high frequencies better, got an error RMS of %f (sinc) and %f (linear)", rootMeanSquare(sincError), rootMeanSquare(linearError))
+	}
+}
+
+func TestNormalizeToDBFS(t *testing.T) {
+	samples := []float64{0.1, -0.5, 0.25, 0.9, -0.3}
+	for _, ceiling := range []float64{0, -1, -6} {
+		normalized := NormalizeToDBFS(samples, ceiling)
+		peak := 20 * math.Log10(FindPeakAmplitude(normalized))
+		if math.Abs(peak-ceiling) > 1e-9 {
+			t.Errorf("Expected a peak of %.1f dBFS, got %f dBFS", ceiling, peak)
+		}
+	}
+}
+
+func TestGenerateMultichannel(t *testing.T) {
+	cfg, err := NewSettings(nil, 120.0, 50.0, 0.1, 8000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.SoundType = Kick
+	cfg.Drive = 0
+	cfg.WithSeed(1)
+	mono, err := cfg.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	cfg.SoundType = Snare  // the sound type is given by name instead
+	cfg.SurroundAngle = 30 // towards the front right
+	quad, err := cfg.GenerateMultichannel("kick", 4)
+	if err != nil {
+		t.Fatalf("GenerateMultichannel failed: %v", err)
+	}
+	if len(quad) != len(mono)*4 {
+		t.Fatalf("Expected %d interleaved samples, got %d", len(mono)*4, len(quad))
+	}
+	levels := make([]float64, 4)
+	for c := range levels {
+		channel := make([]float64, len(mono))
+		for i := range channel {
+			channel[i] = quad[i*4+c]
+		}
+		levels[c] = rootMeanSquare(channel)
+		if levels[c] == 0 {
+			t.Errorf("Expected channel %d to be non-silent", c)
+		} else if c := correlation(channel, mono); c < 0.999 {
+			t.Errorf("Expected each channel to carry the kick, got a correlation of %f", c)
+		}
+	}
+	// Front right should be the loudest channel
+	if levels[1] <= levels[0] || levels[1] <= levels[3] {
+		t.Errorf("Expected the front right channel to be the loudest, got %v", levels)
+	}
+	if _, err := cfg.GenerateMultichannel("kick", 0); err == nil {
+		t.Error("Expected an error for 0 channels")
+	}
+	if _, err := cfg.GenerateMultichannel("cowbell", 4); err == nil {
+		t.Error("Expected an error for an unknown sound type")
+	}
+}
+
+func TestParseSoundType(t *testing.T) {
+	for soundType := SoundType(Kick); soundType <= Lead; soundType++ {
+		if parsed, err := ParseSoundType(soundType.String()); err != nil || parsed != soundType {
+			t.Errorf("Expected %s to be parsed as %d, got %d (%v)", soundType, soundType, parsed, err)
+		}
+	}
+	if _, err := ParseSoundType("cowbell"); err == nil {
+		t.Error("Expected an error for an unknown sound type")
+	}
+}
+
+// zeroCrossingRate returns the number of zero crossings per second
+func zeroCrossingRate(samples []float64, sampleRate int) float64 {
+	crossings := 0
+	for i := 1; i < len(samples); i++ {
+		if (samples[i-1] < 0) != (samples[i] < 0) {
+			crossings++
+		}
+	}
+	return float64(crossings) * float64(sampleRate) / float64(len(samples))
+}
+
+func TestGenerateMorph(t *testing.T) {
+	cfg, err := NewSettings(nil, 300.0, 300.0, 0.5, 8000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.Attack = 0.001
+	cfg.Decay = 0.1
+	cfg.Sustain = 0.7
+	cfg.Release = 0.05
+	cfg.Drive = 0
+	cfg.NoiseAmount = 1.0
+	cfg.FilterCutoff = 3500
+	samples, err := cfg.GenerateMorph(1, 1)
+	if err != nil {
+		t.Fatalf("GenerateMorph failed: %v", err)
+	}
+	early, late := samples[100:900], samples[2900:3700]
+	if f := peakFrequency(early, cfg.SampleRate); math.Abs(f-300) > 20 {
+		t.Errorf("Expected the early portion to have a pitch near 300 Hz, got %f Hz", f)
+	}
+	earlyZCR, lateZCR := zeroCrossingRate(early, cfg.SampleRate), zeroCrossingRate(late, cfg.SampleRate)
+	if earlyZCR > 700 {
+		t.Errorf("Expected a zero crossing rate close to 600 for the early portion, got %f", earlyZCR)
+	}
+	if lateZCR < 2*earlyZCR {
+		t.Errorf("Expected the late portion to be noisy, got a zero crossing rate of %f (early: %f)", lateZCR, earlyZCR)
+	}
+	if _, err := cfg.GenerateMorph(1.5, 1); err == nil {
+		t.Error("Expected an error for a startTonal above 1")
+	}
+}
+
+func TestWaveformStats(t *testing.T) {
+	samples := make([]float64, 1000)
+	for i := range samples {
+		samples[i] = 0.5 * math.Sin(2*math.Pi*float64(i)/100)
+	}
+	peak, rms, crestFactor, dcOffset := WaveformStats(samples)
+	if math.Abs(peak-0.5) > 1e-9 {
+		t.Errorf("Expected a peak of 0.5, got %f", peak)
+	}
+	if math.Abs(rms-0.5/math.Sqrt2) > 1e-9 {
+		t.Errorf("Expected an RMS of %f, got %f", 0.5/math.Sqrt2, rms)
+	}
+	if math.Abs(crestFactor-math.Sqrt2) > 1e-9 {
+		t.Errorf("Expected a crest factor of %f, got %f", math.Sqrt2, crestFactor)
+	}
+	if math.Abs(dcOffset) > 1e-9 {
+		t.Errorf("Expected a DC offset of 0, got %f", dcOffset)
+	}
+	if _, _, _, dcOffset := WaveformStats([]float64{0.25, 0.75}); dcOffset != 0.5 {
+		t.Errorf("Expected a DC offset of 0.5, got %f", dcOffset)
+	}
+}
+
+func TestLinkwitzRileyCrossover(t *testing.T) {
+	sampleRate := 8000
+	impulse := make([]float64, 2048)
+	impulse[0] = 1
+	bands := LinkwitzRileyCrossover(impulse, []float64{1000, 200}, sampleRate)
+	if len(bands) != 3 {
+		t.Fatalf("Expected 3 bands, got %d", len(bands))
+	}
+	summed := make([]float64, len(impulse))
+	for _, band := range bands {
+		if len(band) != len(impulse) {
+			t.Fatalf("Expected bands of length %d, got %d", len(impulse), len(band))
+		}
+		for i, sample := range band {
+			summed[i] += sample
+		}
+	}
+	// The spectrum of an impulse is flat, so the spectrum of the summed bands should be flat too
+	for k, m := range magnitudeSpectrum(summed) {
+		if math.Abs(m-1) > 0.01 {
+			t.Errorf("Expected a flat response, got a magnitude of %f at %f Hz", m, float64(k)*float64(sampleRate)/float64(len(impulse)))
+			break
+		}
+	}
+	// The low band should mainly contain the low frequencies
+	lowSpectrum := magnitudeSpectrum(bands[0])
+	if lowSpectrum[10] < 0.9 || lowSpectrum[700] > 0.01 {
+		t.Errorf("Expected the low band to pass 39 Hz and block 2734 Hz, got %f and %f", lowSpectrum[10], lowSpectrum[700])
+	}
+}
+
+func TestAutoTrim(t *testing.T) {
+	cfg, err := NewSettings(nil, 120.0, 50.0, 1.0, 44100, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.Attack = 0.001
+	cfg.Decay = 0.05
+	cfg.Sustain = 0
+	cfg.Release = 0.01
+	cfg.Drive = 0
+	full, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick failed: %v", err)
+	}
+	cfg.AutoTrim = true
+	trimmed, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick with AutoTrim failed: %v", err)
+	}
+	if len(full) != 44100 {
+		t.Errorf("Expected 44100 samples without AutoTrim, got %d", len(full))
+	}
+	if len(trimmed) == 0 || len(trimmed) > len(full)/4 {
+		t.Fatalf("Expected far fewer than %d samples with AutoTrim, got %d", len(full), len(trimmed))
+	}
+	if last := math.Abs(trimmed[len(trimmed)-1]); last < AutoTrimThreshold {
+		t.Errorf("Expected the last sample to be above the trim threshold, got %f", last)
+	}
+}
+
+func TestBitcrusherDithered(t *testing.T) {
+	sampleRate := 4000
+	samples := make([]float64, sampleRate)
+	for i := range samples {
+		samples[i] = 0.8 * math.Sin(2*math.Pi*40*float64(i)/float64(sampleRate))
+	}
+	// harmonicFraction returns the fraction of the quantization error energy that lies on
+	// the harmonics of the 40 Hz input, which is close to 1 when the error follows the signal
+	harmonicFraction := func(crushed []float64) float64 {
+		quantizationError := make([]float64, len(samples))
+		for i := range samples {
+			quantizationError[i] = crushed[i] - samples[i]
+		}
+		var harmonic, total float64
+		for k, m := range magnitudeSpectrum(quantizationError) {
+			if k%40 == 0 {
+				harmonic += m * m
+			}
+			total += m * m
+		}
+		return harmonic / total
+	}
+	plain := harmonicFraction(ApplyBitcrusher(samples, 3, 1))
+	dithered := harmonicFraction(BitcrusherDithered(samples, 3, 1))
+	if plain < 0.8 {
+		t.Errorf("Expected the plain bitcrusher error to follow the signal, got a harmonic fraction of %f", plain)
+	}
+	if dithered > 0.2 {
+		t.Errorf("Expected the dithered bitcrusher error to be decorrelated from the signal, got a harmonic fraction of %f", dithered)
+	}
+}
+
+func TestApplyExponentialDecay(t *testing.T) {
+	sampleRate := 1000
+	ones := make([]float64, sampleRate)
+	for i := range ones {
+		ones[i] = 1
+	}
+	decayed := ApplyExponentialDecay(ones, 0.1, sampleRate)
+	if decayed[0] != 1 {
+		t.Errorf("Expected the envelope to start at 1, got %f", decayed[0])
+	}
+	if math.Abs(decayed[100]-1/math.E) > 1e-9 {
+		t.Errorf("Expected the envelope to be 1/e after the decay time, got %f", decayed[100])
+	}
+	for i := 1; i < len(decayed); i++ {
+		if decayed[i] >= decayed[i-1] {
+			t.Fatalf("Expected the envelope to be monotonically decreasing, got %f after %f at sample %d", decayed[i], decayed[i-1], i)
+		}
+	}
+	// Generators should use the exponential decay when UseExponentialDecay is enabled
+	cfg, err := NewSettings(nil, 100.0, 100.0, 0.5, sampleRate, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.Decay = 0.1
+	cfg.UseExponentialDecay = true
+	if v := cfg.ApplyEnvelopeAtTime(0.1); math.Abs(v-1/math.E) > 1e-9 {
+		t.Errorf("Expected ApplyEnvelopeAtTime to give 1/e at the decay time, got %f", v)
+	}
+}
+
+// correlation returns the Pearson correlation coefficient of two equally long signals
+func correlation(a, b []float64) float64 {
+	var meanA, meanB float64
+	for i := range a {
+		meanA += a[i]
+		meanB += b[i]
+	}
+	meanA /= float64(len(a))
+	meanB /= float64(len(b))
+	var cov, varA, varB float64
+	for i := range a {
+		cov += (a[i] - meanA) * (b[i] - meanB)
+		varA += (a[i] - meanA) * (a[i] - meanA)
+		varB += (b[i] - meanB) * (b[i] - meanB)
+	}
+	if varA == 0 || varB == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varA*varB)
+}
+
+func TestApplyStereoChorus(t *testing.T) {
+	sampleRate := 44100
+	samples := GenerateWhiteNoise(sampleRate, 1.0)
+	left, right := ApplyStereoChorus(samples, sampleRate, 0.015, 0.005, 1.5, 0.5)
+	if len(left) != len(samples) || len(right) != len(samples) {
+		t.Fatalf("Expected channels of length %d, got %d and %d", len(samples), len(left), len(right))
+	}
+	if c := correlation(left, right); c > 0.8 {
+		t.Errorf("Expected the left and right channels to be decorrelated, got a correlation of %f", c)
+	}
+	for name, channel := range map[string][]float64{"left": left, "right": right} {
+		if c := correlation(channel, samples); c < 0.5 {
+			t.Errorf("Expected the %s channel to retain the input, got a correlation of %f", name, c)
+		}
+	}
+}
+
+func TestCleanTail(t *testing.T) {
+	sampleRate := 8000
+	const step = 1.0 / 32768
+	samples := make([]float64, sampleRate)
+	for i := range samples {
+		samples[i] = 0.4 * step * math.Sin(2*math.Pi*50*float64(i)/float64(sampleRate))
+	}
+	cleaned := CleanTail(samples, 1.0, sampleRate)
+	if last := cleaned[len(cleaned)-1]; last != 0 {
+		t.Errorf("Expected the last sample to be 0, got %g", last)
+	}
+	// A constant signal should taper smoothly and monotonically to zero
+	ones := make([]float64, 1000)
+	for i := range ones {
+		ones[i] = 1
+	}
+	faded := CleanTail(ones, 0.1, sampleRate)
+	for i := 201; i < len(faded); i++ {
+		if faded[i] > faded[i-1]+2*step || faded[i-1]-faded[i] > 0.01 {
+			t.Fatalf("Expected a smooth fade to zero, got %f after %f at sample %d", faded[i], faded[i-1], i)
+		}
+	}
+	// The 16-bit quantization error of a signal below one step should not follow the signal when it is dithered
+	reference := make([]float64, len(samples)/2)
+	for i := range reference {
+		reference[i] = samples[i] * (0.5 + 0.5*math.Cos(math.Pi*float64(i+1)/float64(len(samples))))
+	}
+	quantizationError := func(output []float64) []float64 {
+		e := make([]float64, len(reference))
+		for i := range e {
+			e[i] = math.Round(output[i]/step)*step - reference[i]
+		}
+		return e
+	}
+	plain := correlation(quantizationError(reference), reference)
+	dithered := correlation(quantizationError(cleaned), reference)
+	if plain > -0.9 {
+		t.Errorf("Expected the plain quantization error to follow the signal, got a correlation of %f", plain)
+	}
+	if math.Abs(dithered) > 0.5 {
+		t.Errorf("Expected the dithered quantization error to be decorrelated, got a correlation of %f", dithered)
+	}
+}
+
+func TestDuckBy(t *testing.T) {
+	sampleRate := 8000
+	bass := make([]float64, 2*sampleRate)
+	trigger := make([]float64, len(bass))
+	for i := range bass {
+		bass[i] = 0.5 * math.Sin(2*math.Pi*55*float64(i)/float64(sampleRate))
+	}
+	for _, onset := range []int{0, sampleRate} {
+		for i := 0; i < sampleRate/10; i++ {
+			trigger[onset+i] = math.Exp(-float64(i)/400) * math.Sin(2*math.Pi*60*float64(i)/float64(sampleRate))
+		}
+	}
+	ducked := DuckBy(bass, trigger, 0.8, 0.1, sampleRate)
+	if len(ducked) != len(bass) {
+		t.Fatalf("Expected %d samples, got %d", len(bass), len(ducked))
+	}
+	level := func(samples []float64, from, to float64) float64 {
+		return rootMeanSquare(samples[int(from*float64(sampleRate)):int(to*float64(sampleRate))])
+	}
+	for _, onset := range []float64{0, 1} {
+		if ratio := level(ducked, onset+0.005, onset+0.03) / level(bass, onset+0.005, onset+0.03); ratio > 0.5 {
+			t.Errorf("Expected the bass to be ducked after the trigger at %.0fs, got a level ratio of %f", onset, ratio)
+		}
+	}
+	if ratio := level(ducked, 0.6, 0.95) / level(bass, 0.6, 0.95); ratio < 0.99 {
+		t.Errorf("Expected the bass to recover between the triggers, got a level ratio of %f", ratio)
+	}
+}
+
+func TestNoiseEnvelope(t *testing.T) {
+	cfg, err := NewSettings(nil, 200.0, 180.0, 0.5, 22050, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.SoundType = Snare
+	cfg.Attack = 0.001
+	cfg.Decay = 0.05
+	cfg.Sustain = 0
+	cfg.Release = 0.01
+	cfg.Drive = 1.0
+	cfg.NoiseEnvelope = &NoiseEnvelope{Attack: 0.001, Decay: 0.05, Sustain: 0.5, Release: 0.2}
+	if copied := CopySettings(cfg); copied.NoiseEnvelope == cfg.NoiseEnvelope {
+		t.Error("Expected CopySettings to copy the NoiseEnvelope")
+	}
+
+	// Without noise, only the tonal body is left, which should have died out before the tail
+	cfg.NoiseAmount = 0
+	body, err := cfg.GenerateSnare()
+	if err != nil {
+		t.Fatalf("GenerateSnare failed: %v", err)
+	}
+	cfg.NoiseAmount = 1.0
+	full, err := cfg.GenerateSnare()
+	if err != nil {
+		t.Fatalf("GenerateSnare failed: %v", err)
+	}
+	tail := func(samples []float64) []float64 {
+		return samples[int(0.3*float64(cfg.SampleRate)):int(0.45*float64(cfg.SampleRate))]
+	}
+	if level := rootMeanSquare(tail(body)); level > 1e-6 {
+		t.Errorf("Expected the tonal body to have died out in the tail, got an RMS of %f", level)
+	}
+	if level := rootMeanSquare(tail(full)); level < 0.01 {
+		t.Errorf("Expected the noise to ring out in the tail, got an RMS of %f", level)
+	}
+}
+
+func TestAlignByCorrelation(t *testing.T) {
+	a := make([]float64, 2000)
+	for i := 100; i < 600; i++ {
+		a[i] = math.Exp(-float64(i-100)/100) * math.Sin(2*math.Pi*float64(i-100)/40)
+	}
+	const delay = 37
+	b := make([]float64, len(a))
+	copy(b[delay:], a)
+	lag, aligned := AlignByCorrelation(a, b, 100)
+	if lag != delay {
+		t.Errorf("Expected a lag of %d, got %d", delay, lag)
+	}
+	if len(aligned) != len(b) {
+		t.Fatalf("Expected %d aligned samples, got %d", len(b), len(aligned))
+	}
+	for i := range a {
+		if math.Abs(aligned[i]-a[i]) > 1e-12 {
+			t.Fatalf("Expected the aligned samples to match the original at sample %d, got %f and %f", i, aligned[i], a[i])
+		}
+	}
+	if lag, _ := AlignByCorrelation(b, a, 100); lag != -delay {
+		t.Errorf("Expected a lag of %d when b comes first, got %d", -delay, lag)
+	}
+}
+
+func TestAlignDelay(t *testing.T) {
+	reference := GenerateWhiteNoise(1000, 1.0)
+	const delay = 12
+	delayed := make([]float64, len(reference))
+	copy(delayed[delay:], reference)
+	offset, aligned := AlignDelay(reference, delayed)
+	if offset != delay {
+		t.Errorf("Expected an offset of %d, got %d", delay, offset)
+	}
+	for i := 0; i < len(reference)-delay; i++ {
+		if aligned[i] != reference[i] {
+			t.Fatalf("Expected the aligned samples to match the reference at sample %d, got %f and %f", i, aligned[i], reference[i])
+		}
+	}
+	// A negative delay, where the second signal comes first, gives the same offset as AlignByCorrelation
+	early := append(append([]float64(nil), reference[delay:]...), make([]float64, delay)...)
+	offset, _ = AlignDelay(reference, early)
+	if lag, _ := AlignByCorrelation(reference, early, len(reference)/2); offset != -delay || lag != offset {
+		t.Errorf("Expected an offset of %d, like AlignByCorrelation, got %d and %d", -delay, offset, lag)
+	}
+	// A few seconds of audio can be aligned quickly
+	long := GenerateWhiteNoise(5*44100, 1.0)
+	longDelayed := append(make([]float64, 300), long[:len(long)-300]...)
+	if offset, _ := AlignDelay(long, longDelayed); offset != 300 {
+		t.Errorf("Expected an offset of 300, got %d", offset)
+	}
+}
+
+func TestGenerateWavBytes(t *testing.T) {
+	cfg, err := NewSettings(nil, 120.0, 50.0, 0.25, 22050, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.SoundType = Kick
+	data, err := cfg.GenerateWavBytes()
+	if err != nil {
+		t.Fatalf("GenerateWavBytes failed: %v", err)
+	}
+	if len(data) < 44 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		t.Fatalf("Expected a RIFF/WAVE header, got %q", data[:min(len(data), 12)])
+	}
+	filename := "test_wav_bytes.wav"
+	defer os.Remove(filename)
+	if err := os.WriteFile(filename, data, 0o644); err != nil {
+		t.Fatalf("Failed to write WAV bytes: %v", err)
+	}
+	samples, sampleRate, err := playsample.LoadWav(filename, false)
+	if err != nil {
+		t.Fatalf("LoadWav failed: %v", err)
+	}
+	if sampleRate != 22050 {
+		t.Errorf("Expected a sample rate of 22050, got %d", sampleRate)
+	}
+	if expected := int(cfg.Duration * float64(cfg.SampleRate)); len(samples) != expected {
+		t.Errorf("Expected %d samples, got %d", expected, len(samples))
+	}
+}
+
+func TestBlendAndWithMix(t *testing.T) {
+	dry := []float64{0.2, -0.4, 0.6}
+	wet := []float64{1.0, 0.0, -0.6}
+	for i, sample := range Blend(dry, wet, 0) {
+		if sample != dry[i] {
+			t.Errorf("Expected mix 0 to return the dry sample %f, got %f", dry[i], sample)
+		}
+	}
+	for i, sample := range Blend(dry, wet, 1) {
+		if sample != wet[i] {
+			t.Errorf("Expected mix 1 to return the wet sample %f, got %f", wet[i], sample)
+		}
+	}
+	for i, sample := range Blend(dry, wet, 0.5) {
+		if expected := (dry[i] + wet[i]) / 2; math.Abs(sample-expected) > 1e-12 {
+			t.Errorf("Expected mix 0.5 to return the average %f, got %f", expected, sample)
+		}
+	}
+	invert := func(samples []float64) []float64 {
+		inverted := make([]float64, len(samples))
+		for i, sample := range samples {
+			inverted[i] = -sample
+		}
+		return inverted
+	}
+	if mixed := WithMix(invert, 0.5)(dry); mixed[0] != 0 || mixed[1] != 0 {
+		t.Errorf("Expected an inverted signal at mix 0.5 to cancel out, got %v", mixed)
+	}
+	if bypassed := WithMix(invert, 0)(dry); bypassed[0] != dry[0] {
+		t.Errorf("Expected mix 0 to bypass the effect, got %v", bypassed)
+	}
+}
+
+func TestGenerateKickWithTransient(t *testing.T) {
+	// Create a short click, at a different sample rate than the kick
+	click := make([]float64, 88)
+	for i := range click {
+		click[i] = 0.8 * math.Sin(2*math.Pi*3000*float64(i)/44100) * math.Exp(-float64(i)/30)
+	}
+	filename := "test_transient.wav"
+	defer os.Remove(filename)
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("Failed to create WAV file: %v", err)
+	}
+	if err := playsample.SaveToWav(file, click, 44100, 16, 1); err != nil {
+		t.Fatalf("SaveToWav failed: %v", err)
+	}
+	file.Close()
+
+	cfg, err := NewSettings(nil, 120.0, 50.0, 0.3, 22050, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.Attack = 0.02
+	plain, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick failed: %v", err)
+	}
+	layered, err := cfg.GenerateKickWithTransient(filename)
+	if err != nil {
+		t.Fatalf("GenerateKickWithTransient failed: %v", err)
+	}
+	if len(layered) != len(plain) {
+		t.Fatalf("Expected %d samples, got %d", len(plain), len(layered))
+	}
+	// The click lasts 2 ms, so its energy should show up in the first few milliseconds
+	start := int(0.003 * float64(cfg.SampleRate))
+	if plainLevel, layeredLevel := rootMeanSquare(plain[:start]), rootMeanSquare(layered[:start]); layeredLevel < plainLevel+0.1 {
+		t.Errorf("Expected the transient to add energy to the attack, got an RMS of %f (plain) and %f (layered)", plainLevel, layeredLevel)
+	}
+	if _, err := cfg.GenerateKickWithTransient("does_not_exist.wav"); err == nil {
+		t.Error("Expected an error for a missing transient file")
+	}
+
+	// The layered kick goes through the same output chain as a regular kick
+	cfg.OutputGain = 0.5
+	cfg.RetroMode = true
+	processed, err := cfg.GenerateKickWithTransient(filename)
+	if err != nil {
+		t.Fatalf("GenerateKickWithTransient failed: %v", err)
+	}
+	for i, sample := range processed {
+		if math.Abs(sample) > 0.5+1.0/127 {
+			t.Fatalf("Expected the OutputGain to be applied to the layered kick, got %f at %d", sample, i)
+		}
+		if steps := sample * 127; math.Abs(steps-math.Round(steps)) > 1e-9 {
+			t.Fatalf("Expected the layered kick to be quantized in RetroMode, got %f at %d", sample, i)
+		}
+	}
+}
+
+func TestGenerateKickWithStereoTransient(t *testing.T) {
+	// The same click as a mono file and as a stereo file with the click in both channels
+	click := make([]float64, 88)
+	stereoClick := make([]float64, 2*len(click))
+	for i := range click {
+		click[i] = 0.8 * math.Sin(2*math.Pi*3000*float64(i)/44100) * math.Exp(-float64(i)/30)
+		stereoClick[2*i], stereoClick[2*i+1] = click[i], click[i]
+	}
+	save := func(filename string, samples []float64, channels int) {
+		file, err := os.Create(filename)
+		if err != nil {
+			t.Fatalf("Failed to create WAV file: %v", err)
+		}
+		defer file.Close()
+		if err := playsample.SaveToWav(file, samples, 44100, 16, channels); err != nil {
+			t.Fatalf("SaveToWav failed: %v", err)
+		}
+	}
+	monoFilename, stereoFilename := "test_transient_mono.wav", "test_transient_stereo.wav"
+	defer os.Remove(monoFilename)
+	defer os.Remove(stereoFilename)
+	save(monoFilename, click, 1)
+	save(stereoFilename, stereoClick, 2)
+
+	cfg, err := NewSettings(nil, 120.0, 50.0, 0.3, 22050, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.Attack = 0.02
+	mono, err := cfg.GenerateKickWithTransient(monoFilename)
+	if err != nil {
+		t.Fatalf("GenerateKickWithTransient failed: %v", err)
+	}
+	stereo, err := cfg.GenerateKickWithTransient(stereoFilename)
+	if err != nil {
+		t.Fatalf("GenerateKickWithTransient failed: %v", err)
+	}
+	// The stereo click is downmixed, instead of being played at half speed
+	for i := range mono {
+		if math.Abs(mono[i]-stereo[i]) > 1e-3 {
+			t.Fatalf("Expected the stereo click to give the same kick as the mono click, got %f and %f at %d", stereo[i], mono[i], i)
+		}
+	}
+}
+
+func TestApplyExciter(t *testing.T) {
+	sampleRate := 16000
+	samples := make([]float64, 4000)
+	for i := range samples {
+		x := float64(i) / float64(sampleRate)
+		samples[i] = 0.5*math.Sin(2*math.Pi*200*x) + 0.3*math.Sin(2*math.Pi*2000*x)
+	}
+	excited := ApplyExciter(samples, 1.0, 1500, sampleRate)
+	if len(excited) != len(samples) {
+		t.Fatalf("Expected %d samples, got %d", len(samples), len(excited))
+	}
+	// The harmonics of the 2 kHz tone should appear at 4 and 6 kHz
+	if before, after := bandEnergy(samples, 3500, 7000, sampleRate), bandEnergy(excited, 3500, 7000, sampleRate); after < 100*(before+1) {
+		t.Errorf("Expected more high frequency energy, got %f before and %f after", before, after)
+	}
+	if before, after := bandEnergy(samples, 100, 300, sampleRate), bandEnergy(excited, 100, 300, sampleRate); math.Abs(after-before) > 0.01*before {
+		t.Errorf("Expected the low frequencies to be unchanged, got %f before and %f after", before, after)
+	}
+}
+
+func TestStartOffset(t *testing.T) {
+	cfg, err := NewSettings(nil, 120.0, 50.0, 0.5, 8000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	full, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick failed: %v", err)
+	}
+	cfg.StartOffset = 0.05
+	trimmed, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick with StartOffset failed: %v", err)
+	}
+	offset := 400 // 0.05 seconds at 8000 Hz
+	if len(trimmed) != len(full)-offset {
+		t.Fatalf("Expected %d samples, got %d", len(full)-offset, len(trimmed))
+	}
+	for i := 0; i < 1000; i++ {
+		if math.Abs(trimmed[i]-full[i+offset]) > 1e-12 {
+			t.Fatalf("Expected sample %d to match sample %d of the untrimmed kick, got %f and %f", i, i+offset, trimmed[i], full[i+offset])
+		}
+	}
+}
+
+func TestResonantHighPassFilter(t *testing.T) {
+	sampleRate := 8000
+	// gain returns the steady state gain of a filter for a sine at the given frequency
+	gain := func(filter func([]float64) []float64, freq float64) float64 {
+		sine := createSineWave(freq, sampleRate, sampleRate)
+		return rootMeanSquare(filter(sine)[sampleRate/2:]) / rootMeanSquare(sine[sampleRate/2:])
+	}
+	resonant := func(samples []float64) []float64 {
+		return ResonantHighPassFilter(samples, 500, 4, sampleRate)
+	}
+	onePole := func(samples []float64) []float64 {
+		return HighPassFilter(samples, 500, sampleRate)
+	}
+	if g := gain(resonant, 62.5); g > 0.02 {
+		t.Errorf("Expected steep attenuation three octaves below the cutoff, got a gain of %f", g)
+	}
+	if g, gentle := gain(resonant, 125), gain(onePole, 125); g >= gentle/3 {
+		t.Errorf("Expected the resonant high-pass to be steeper than HighPassFilter, got a gain of %f and %f", g, gentle)
+	}
+	if g := gain(resonant, 500); g < 2 {
+		t.Errorf("Expected a resonant bump at the cutoff, got a gain of %f", g)
+	}
+	if g := gain(resonant, 3000); math.Abs(g-1) > 0.1 {
+		t.Errorf("Expected a gain close to 1 well above the cutoff, got %f", g)
+	}
+}
+
+func TestGenerateWind(t *testing.T) {
+	sampleRate := 8000
+	wind := GenerateWind(5.0, 0.8, sampleRate)
+	if len(wind) != 5*sampleRate {
+		t.Fatalf("Expected %d samples, got %d", 5*sampleRate, len(wind))
+	}
+	if centroid := spectralCentroid(wind[:4000], sampleRate); centroid > 1200 {
+		t.Errorf("Expected a low frequency weighted spectrum, got a spectral centroid of %f Hz", centroid)
+	}
+	// Measure the level in blocks of 100 ms
+	var levels []float64
+	for start := 0; start+800 <= len(wind); start += 800 {
+		levels = append(levels, rootMeanSquare(wind[start:start+800]))
+	}
+	lowest, highest := levels[0], levels[0]
+	for i, level := range levels {
+		lowest = math.Min(lowest, level)
+		highest = math.Max(highest, level)
+		if i > 0 && math.Abs(level-levels[i-1]) > 0.5*math.Max(level, levels[i-1]) {
+			t.Errorf("Expected the level to change slowly, got %f after %f", level, levels[i-1])
+		}
+	}
+	if lowest == 0 || highest/lowest < 1.5 {
+		t.Errorf("Expected the level to vary over time, got levels between %f and %f", lowest, highest)
+	}
+}
+
+func TestArpeggiate(t *testing.T) {
+	cfg, err := NewSettings(nil, 440.0, 440.0, 1.0, 8000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.SoundType = Xylophone
+	cfg.Attack = 0.005
+	cfg.Decay = 0.05
+	cfg.Sustain = 0.5
+	cfg.Release = 0.02
+	chord := []int{67, 60, 64} // C major, in any order
+	arpeggio, err := cfg.Arpeggiate(chord, "up", 120, 1)
+	if err != nil {
+		t.Fatalf("Arpeggiate failed: %v", err)
+	}
+	stepSamples := 1000 // a 16th note at 120 BPM and 8000 Hz
+	if len(arpeggio) != 16*stepSamples {
+		t.Fatalf("Expected %d samples, got %d", 16*stepSamples, len(arpeggio))
+	}
+	expected := []int{60, 64, 67, 60, 64, 67}
+	for step, note := range expected {
+		freq := peakFrequency(arpeggio[step*stepSamples:(step+1)*stepSamples], cfg.SampleRate)
+		if want := MIDINoteToFrequency(note); math.Abs(freq-want) > 10 {
+			t.Errorf("Expected step %d to play note %d at %f Hz, got %f Hz", step, note, want, freq)
+		}
+	}
+	if _, err := cfg.Arpeggiate(chord, "sideways", 120, 1); err == nil {
+		t.Error("Expected an error for an unknown pattern")
+	}
+
+	// The random pattern only picks chord notes, in the same order for the same Seed
+	randomNotes := func() []int {
+		arpeggio, err := cfg.Arpeggiate(chord, "random", 120, 1)
+		if err != nil {
+			t.Fatalf("Arpeggiate failed: %v", err)
+		}
+		notes := make([]int, 16)
+		for step := range notes {
+			freq := peakFrequency(arpeggio[step*stepSamples:(step+1)*stepSamples], cfg.SampleRate)
+			for _, note := range chord {
+				if math.Abs(freq-MIDINoteToFrequency(note)) <= 10 {
+					notes[step] = note
+				}
+			}
+			if notes[step] == 0 {
+				t.Errorf("Expected step %d to play a chord note, got %f Hz", step, freq)
+			}
+		}
+		return notes
+	}
+	cfg.WithSeed(7)
+	first, second := randomNotes(), randomNotes()
+	for step := range first {
+		if first[step] != second[step] {
+			t.Fatalf("Expected the same random notes for the same seed, got %v and %v", first, second)
+		}
+	}
+}
+
+func TestSaveToWavNoiseShaped(t *testing.T) {
+	sampleRate := 44100
+	samples := createSineWave(440, 4096, sampleRate)
+	for i := range samples {
+		samples[i] *= 0.3
+	}
+	const maxIntValue = 32767
+	shaped := noiseShapedQuantize(rand.New(rand.NewSource(1)), samples, 16, 1)
+	r := rand.New(rand.NewSource(2))
+	flat := make([]float64, len(samples))
+	for i, sample := range samples {
+		flat[i] = math.Round(sample*maxIntValue+r.Float64()-r.Float64()) / maxIntValue
+	}
+	quantizationError := func(quantized []float64) []float64 {
+		e := make([]float64, len(samples))
+		for i := range samples {
+			if q := quantized[i] * maxIntValue; q != math.Round(q) {
+				t.Fatalf("Expected sample %d to be on the 16-bit grid, got %f", i, q)
+			}
+			e[i] = quantized[i] - samples[i]
+		}
+		return e
+	}
+	shapedInBand := bandEnergy(quantizationError(shaped), 0, 4000, sampleRate)
+	flatInBand := bandEnergy(quantizationError(flat), 0, 4000, sampleRate)
+	if shapedInBand >= flatInBand/4 {
+		t.Errorf("Expected less in-band quantization noise with noise shaping, got %g (shaped) and %g (flat)", shapedInBand, flatInBand)
+	}
+
+	filename := "test_noise_shaped.wav"
+	defer os.Remove(filename)
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("Failed to create WAV file: %v", err)
+	}
+	if err := SaveToWavNoiseShaped(file, samples, sampleRate, 16, 1); err != nil {
+		t.Fatalf("SaveToWavNoiseShaped failed: %v", err)
+	}
+	file.Close()
+	loaded, _, err := playsample.LoadWav(filename, false)
+	if err != nil {
+		t.Fatalf("LoadWav failed: %v", err)
+	}
+	if len(loaded) != len(samples) {
+		t.Errorf("Expected %d samples, got %d", len(samples), len(loaded))
+	}
+}
+
+func TestNoiseShapedQuantizeFullScale(t *testing.T) {
+	// A full scale sine, then a stretch that is held at full scale, and then a quiet sine
+	samples := createSineWave(440, 4096, 44100)
+	for i := 0; i < 1000; i++ {
+		samples = append(samples, 1)
+	}
+	for _, sample := range createSineWave(440, 4096, 44100) {
+		samples = append(samples, 0.1*sample)
+	}
+	const maxIntValue = 32767
+	shaped := noiseShapedQuantize(rand.New(rand.NewSource(1)), samples, 16, 1)
+	for i, sample := range samples {
+		if e := math.Abs(shaped[i]-sample) * maxIntValue; e > 8 {
+			t.Fatalf("Expected the quantization error to stay within a few steps at full scale, got %.1f steps at %d", e, i)
+		}
+	}
+	again := noiseShapedQuantize(rand.New(rand.NewSource(1)), samples, 16, 1)
+	for i := range shaped {
+		if shaped[i] != again[i] {
+			t.Fatalf("Expected the same dither for the same source, at %d", i)
+		}
+	}
+}
+
+func TestMeter(t *testing.T) {
+	sampleRate := 1000
+	meter := NewMeter(0.1, sampleRate)
+	meter.Update([]float64{0.1, -0.9, 0.2})
+	if peak := meter.PeakHold(); math.Abs(peak-0.9*math.Exp(-1.0/100)) > 1e-9 {
+		t.Errorf("Expected a held peak of about 0.9, got %f", peak)
+	}
+	// A quieter buffer should not replace the held peak, but let it fall back
+	quiet := createTestWaveform(0.1, 100)
+	meter.Update(quiet)
+	if peak := meter.PeakHold(); peak <= 0.1 || peak >= 0.9 {
+		t.Errorf("Expected the held peak to decay from 0.9 but stay above 0.1, got %f", peak)
+	}
+	if rms := meter.RMS(); math.Abs(rms-0.1) > 1e-9 {
+		t.Errorf("Expected an RMS of 0.1 for the latest buffer, got %f", rms)
+	}
+	// After a long time, the held peak should have fallen to the current level
+	for i := 0; i < 10; i++ {
+		meter.Update(quiet)
+	}
+	if peak := meter.PeakHold(); math.Abs(peak-0.1) > 1e-9 {
+		t.Errorf("Expected the held peak to fall back to 0.1, got %f", peak)
+	}
+}
+
+func TestMakeSeamlessDrone(t *testing.T) {
+	cfg, err := NewSettings(nil, 55.0, 55.0, 1.0, 8000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.FilterCutoff = 400
+	drone, err := cfg.MakeSeamlessDrone(1.0, 0.1)
+	if err != nil {
+		t.Fatalf("MakeSeamlessDrone failed: %v", err)
+	}
+	if len(drone) != 8000 {
+		t.Fatalf("Expected 8000 samples, got %d", len(drone))
+	}
+	// The jump from the last sample back to the first should be no larger than the steps within the drone
+	largestStep := 0.0
+	for i := 1; i < len(drone); i++ {
+		largestStep = math.Max(largestStep, math.Abs(drone[i]-drone[i-1]))
+	}
+	if wrap := math.Abs(drone[0] - drone[len(drone)-1]); wrap > largestStep {
+		t.Errorf("Expected a seamless loop boundary, got a jump of %f (the largest step within the drone is %f)", wrap, largestStep)
+	}
+	if _, err := cfg.MakeSeamlessDrone(1.0, 2.0); err == nil {
+		t.Error("Expected an error for a crossfade that is longer than the drone")
+	}
+}
+
+func TestNoLimiter(t *testing.T) {
+	cfg, err := NewSettings(nil, 120.0, 50.0, 0.2, 8000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.Drive = 0
+	cfg.OscillatorLevels = []float64{3.0}
+	limited, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick failed: %v", err)
+	}
+	if peak := FindPeakAmplitude(limited); peak > 1 {
+		t.Errorf("Expected the limiter to keep the peak within 1, got %f", peak)
+	}
+	cfg.NoLimiter = true
+	raw, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick with NoLimiter failed: %v", err)
+	}
+	if peak := FindPeakAmplitude(raw); peak < 2 {
+		t.Errorf("Expected the over-range signal to be preserved with NoLimiter, got a peak of %f", peak)
+	}
+}
+
+func TestGenerateFlam(t *testing.T) {
+	cfg, err := NewSettings(nil, 200.0, 150.0, 0.2, 8000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.SoundType = Kick
+	cfg.Attack = 0.001
+	cfg.Decay = 0.1
+	cfg.Sustain = 0.2
+	cfg.Drive = 0
+	flam, err := cfg.GenerateFlam(0.03, 0.4)
+	if err != nil {
+		t.Fatalf("GenerateFlam failed: %v", err)
+	}
+	offset := 240 // 30 ms at 8000 Hz
+	if len(flam) != 1600+offset {
+		t.Fatalf("Expected %d samples, got %d", 1600+offset, len(flam))
+	}
+	window := 40 // 5 ms
+	grace := rootMeanSquare(flam[:window])
+	beforeMain := rootMeanSquare(flam[offset-window : offset])
+	main := rootMeanSquare(flam[offset : offset+window])
+	if grace == 0 || grace >= main {
+		t.Errorf("Expected a grace note that is quieter than the main hit, got an RMS of %f and %f", grace, main)
+	}
+	if main < 2*beforeMain {
+		t.Errorf("Expected a second transient at %d samples, got an RMS of %f before and %f after", offset, beforeMain, main)
+	}
+}
+
+func TestApplyReverbAutomated(t *testing.T) {
+	sampleRate := 8000
+	samples := GenerateWhiteNoise(2*sampleRate, 0.5)
+	delayTimes := []float64{0.031, 0.043, 0.057}
+	decays := []float64{0.5, 0.4, 0.3}
+	ramp := NewAutomation(AutomationPoint{Time: 2, Value: 1}, AutomationPoint{Time: 0, Value: 0})
+	if v := ramp.ValueAt(0.5); math.Abs(v-0.25) > 1e-12 {
+		t.Errorf("Expected the automation to be 0.25 at 0.5s, got %f", v)
+	}
+	reverbed, err := ApplyReverbAutomated(samples, sampleRate, delayTimes, decays, ramp)
+	if err != nil {
+		t.Fatalf("ApplyReverbAutomated failed: %v", err)
+	}
+	if len(reverbed) != len(samples) {
+		t.Fatalf("Expected %d samples, got %d", len(samples), len(reverbed))
+	}
+	// The dry signal is white noise, so the correlation with it drops as the wet proportion increases
+	window := sampleRate / 4
+	early := correlation(reverbed[window:2*window], samples[window:2*window])
+	late := correlation(reverbed[len(samples)-window:], samples[len(samples)-window:])
+	if late >= early-0.3 {
+		t.Errorf("Expected the wet proportion to increase over time, got a correlation with the dry signal of %f early and %f late", early, late)
+	}
+}
+
+func TestFastSin(t *testing.T) {
+	const steps = 100000
+	for i := 0; i <= steps; i++ {
+		phase := 2 * math.Pi * float64(i) / steps
+		if diff := math.Abs(fastSin(phase) - math.Sin(phase)); diff > 1e-6 {
+			t.Fatalf("Expected fastSin to match math.Sin within 1e-6, got a difference of %g at phase %f", diff, phase)
+		}
+	}
+	for _, phase := range []float64{-1, -100.5, 12345.678} {
+		if diff := math.Abs(fastSin(phase) - math.Sin(phase)); diff > 1e-6 {
+			t.Errorf("Expected fastSin to match math.Sin within 1e-6, got a difference of %g at phase %f", diff, phase)
+		}
+	}
+	// A kick that is generated with FastMath should sound the same
+	cfg, err := NewSettings(nil, 120.0, 50.0, 0.2, 8000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	exact, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick failed: %v", err)
+	}
+	cfg.FastMath = true
+	fast, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick with FastMath failed: %v", err)
+	}
+	for i := range exact {
+		if math.Abs(fast[i]-exact[i]) > 1e-5 {
+			t.Fatalf("Expected the FastMath kick to match at sample %d, got %f and %f", i, fast[i], exact[i])
+		}
+	}
+}
+
+func BenchmarkMathSin(b *testing.B) {
+	sum := 0.0
+	for i := 0; i < b.N; i++ {
+		sum += math.Sin(float64(i) * 0.01)
+	}
+	_ = sum
+}
+
+func BenchmarkFastSin(b *testing.B) {
+	sum := 0.0
+	for i := 0; i < b.N; i++ {
+		sum += fastSin(float64(i) * 0.01)
+	}
+	_ = sum
+}
+
+func TestQuantizeOnsets(t *testing.T) {
+	onsets := []int{3, 98, 205, 310, -4}
+	snapped := QuantizeOnsets(onsets, 100, 1)
+	expected := []int{0, 100, 200, 300, 0}
+	for i := range expected {
+		if snapped[i] != expected[i] {
+			t.Errorf("Expected onset %d to snap to %d, got %d", onsets[i], expected[i], snapped[i])
+		}
+	}
+	unchanged := QuantizeOnsets(onsets, 100, 0)
+	for i := range onsets {
+		if unchanged[i] != onsets[i] {
+			t.Errorf("Expected onset %d to stay put at strength 0, got %d", onsets[i], unchanged[i])
+		}
+	}
+	if halfway := QuantizeOnsets([]int{310}, 100, 0.5); halfway[0] != 305 {
+		t.Errorf("Expected onset 310 to move halfway to 305, got %d", halfway[0])
+	}
+}
+
+func TestSilenceRegions(t *testing.T) {
+	sampleRate := 8000
+	samples := make([]float64, 4000)
+	samples = append(samples, createSineWave(440, 4000, sampleRate)...)
+	regions := SilenceRegions(samples, -60, sampleRate)
+	if len(regions) != 1 {
+		t.Fatalf("Expected 1 silent region, got %d: %v", len(regions), regions)
+	}
+	if regions[0][0] != 0 || regions[0][1] != 0.5 {
+		t.Errorf("Expected a silent region from 0s to 0.5s, got %v", regions[0])
+	}
+	// A trailing silent region should end at the end of the samples
+	samples = append(samples, make([]float64, 800)...)
+	if regions := SilenceRegions(samples, -60, sampleRate); len(regions) != 2 || regions[1] != [2]float64{1.0, 1.1} {
+		t.Errorf("Expected a trailing silent region from 1s to 1.1s, got %v", regions)
+	}
+}
+
+func TestSnapTransient(t *testing.T) {
+	sampleRate := 44100
+	snap := SnapTransient(3000, 0.02, sampleRate)
+	if len(snap) != 882 {
+		t.Fatalf("Expected 882 samples, got %d", len(snap))
+	}
+	if peak := FindPeakAmplitude(snap); math.Abs(peak-1) > 1e-9 {
+		t.Errorf("Expected a peak of 1, got %f", peak)
+	}
+	total, early := 0.0, 0.0
+	for i, sample := range snap {
+		total += sample * sample
+		if i < sampleRate*5/1000 {
+			early += sample * sample
+		}
+	}
+	if early < 0.9*total {
+		t.Errorf("Expected at least 90%% of the energy in the first 5 ms, got %.1f%%", 100*early/total)
+	}
+	if high := bandEnergy(snap, 1000, float64(sampleRate)/2, sampleRate); high < 0.9*bandEnergy(snap, 0, float64(sampleRate)/2, sampleRate) {
+		t.Errorf("Expected at least 90%% of the energy above 1 kHz")
+	}
+}
+
+func TestApplyStereoDelayPingPong(t *testing.T) {
+	sampleRate := 1000
+	left := make([]float64, 1000)
+	right := make([]float64, 1000)
+	left[0] = 1
+	// Without ping-pong, the right channel stays silent
+	_, plainRight := ApplyStereoDelay(left, right, sampleRate, 0.1, 0.15, 0.5, 1.0, false)
+	if peak := FindPeakAmplitude(plainRight); peak != 0 {
+		t.Errorf("Expected a silent right channel without ping-pong, got a peak of %f", peak)
+	}
+	pingLeft, pingRight := ApplyStereoDelay(left, right, sampleRate, 0.1, 0.15, 0.5, 1.0, true)
+	if pingLeft[100] != 1 {
+		t.Errorf("Expected the left echo after 100 ms, got %f", pingLeft[100])
+	}
+	// The echo bounces over to the right channel after both delays
+	if pingRight[250] != 0.5 {
+		t.Errorf("Expected the right echo after 250 ms, got %f", pingRight[250])
+	}
+	for i, sample := range pingRight[:250] {
+		if sample != 0 {
+			t.Fatalf("Expected the right channel to be silent before the echo, got %f at %d ms", sample, i)
+		}
+	}
+}
+
+func TestFlangerStereo(t *testing.T) {
+	sampleRate := 44100
+	// largestSecondDifference measures how abruptly a signal changes, which reveals zipper artifacts
+	largestSecondDifference := func(samples []float64) float64 {
+		largest := 0.0
+		for i := sampleRate / 10; i < len(samples)-1; i++ {
+			largest = math.Max(largest, math.Abs(samples[i+1]-2*samples[i]+samples[i-1]))
+		}
+		return largest
+	}
+	sine := createSineWave(1000, sampleRate, sampleRate)
+	left, right := FlangerStereo(sine, sine, 0.003, 0.002, 0.5, 0, 0.5, sampleRate)
+	if len(left) != len(sine) || len(right) != len(sine) {
+		t.Fatalf("Expected channels of length %d, got %d and %d", len(sine), len(left), len(right))
+	}
+	dry := largestSecondDifference(sine)
+	if smooth := largestSecondDifference(left); smooth > 1.5*dry {
+		t.Errorf("Expected the delay sweep to be smooth, got a largest second difference of %f (dry: %f)", smooth, dry)
+	}
+	if zipper := largestSecondDifference(ApplyFlanger(sine, sampleRate, 0.003, 0.002, 0.5, 0, 0.5)); zipper < 2*dry {
+		t.Errorf("Expected the integer delay flanger to have zipper artifacts, got a largest second difference of %f (dry: %f)", zipper, dry)
+	}
+	noise := GenerateWhiteNoise(sampleRate, 1.0)
+	noiseLeft, noiseRight := FlangerStereo(noise, noise, 0.003, 0.002, 0.5, 0.5, 1.0, sampleRate)
+	if c := correlation(noiseLeft, noiseRight); c > 0.5 {
+		t.Errorf("Expected the channels to be decorrelated, got a correlation of %f", c)
+	}
+}
+
+func TestRenderAB(t *testing.T) {
+	a, err := NewSettings(nil, 120.0, 50.0, 0.3, 8000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	b := CopySettings(a)
+	b.OscillatorLevels = []float64{0.3}
+	aSamples, bSamples, err := RenderAB(a, b, "kick")
+	if err != nil {
+		t.Fatalf("RenderAB failed: %v", err)
+	}
+	aRMS, bRMS := rootMeanSquare(aSamples), rootMeanSquare(bSamples)
+	if aRMS == 0 || math.Abs(aRMS-bRMS) > 1e-9 {
+		t.Errorf("Expected equal RMS levels, got %f and %f", aRMS, bRMS)
+	}
+	if peak := FindPeakAmplitude(aSamples); peak > 1 {
+		t.Errorf("Expected the louder preset to be turned down, got a peak of %f", peak)
+	}
+	if _, _, err := RenderAB(a, b, "cowbell"); err == nil {
+		t.Error("Expected an error for an unknown sound type")
+	}
+}
+
+func TestSyncOscillators(t *testing.T) {
+	cfg, err := NewSettings(nil, 100.0, 50.0, 0.3, 4000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.Drive = 0
+	cfg.NumOscillators = 2
+	cfg.OscillatorLevels = []float64{1.0, 1.0}
+	free, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick failed: %v", err)
+	}
+	cfg.SyncOscillators = true
+	synced, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick with SyncOscillators failed: %v", err)
+	}
+	freeSub := bandEnergy(free, 30, 130, cfg.SampleRate)
+	syncedSub := bandEnergy(synced, 30, 130, cfg.SampleRate)
+	if syncedSub < 1.5*freeSub {
+		t.Errorf("Expected more sub energy with synced oscillators, got %f (synced) and %f (free running)", syncedSub, freeSub)
+	}
+}
+
+func TestGenerateGroove(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	count := func(groove map[string][]bool) int {
+		hits := 0
+		for _, steps := range groove {
+			for _, on := range steps {
+				if on {
+					hits++
+				}
+			}
+		}
+		return hits
+	}
+	if hits := count(GenerateGroove(120, 16, 0, rng)); hits != 0 {
+		t.Errorf("Expected empty patterns at density 0, got %d hits", hits)
+	}
+	busy := GenerateGroove(120, 16, 1, rng)
+	if hits := count(busy); hits < 3*16/2 {
+		t.Errorf("Expected mostly filled patterns at density 1, got %d hits out of %d steps", hits, 3*16)
+	}
+	for _, step := range []int{4, 12} {
+		if !busy["snare"][step] {
+			t.Errorf("Expected the snare on the backbeat at step %d", step)
+		}
+	}
+	if !busy["kick"][0] {
+		t.Error("Expected the kick on the first beat")
+	}
+	p, err := GrooveToPattern(120, busy)
+	if err != nil {
+		t.Fatalf("GrooveToPattern failed: %v", err)
+	}
+	if len(p.Steps) != count(busy) {
+		t.Errorf("Expected %d steps in the pattern, got %d", count(busy), len(p.Steps))
+	}
+}
+
+func TestCymbalReverbTail(t *testing.T) {
+	cfg := NewRandom(Crash, nil, 44100, 16, 1)
+	cfg.Drive = 1.0
+	dry, err := cfg.GenerateCrash()
+	if err != nil {
+		t.Fatalf("GenerateCrash failed: %v", err)
+	}
+	cfg.CymbalReverbTail = 1.0
+	wet, err := cfg.GenerateCrash()
+	if err != nil {
+		t.Fatalf("GenerateCrash failed: %v", err)
+	}
+	if expected := len(dry) + cfg.SampleRate; len(wet) != expected {
+		t.Fatalf("Expected %d samples with the reverb tail, got %d", expected, len(wet))
+	}
+	// The RMS of consecutive windows in the tail should keep falling
+	window := cfg.SampleRate / 20
+	tail := wet[len(dry):]
+	previous := math.Inf(1)
+	for start := 0; start+window <= len(tail); start += window {
+		rms := rootMeanSquare(tail[start : start+window])
+		if rms > previous*1.1 {
+			t.Errorf("Expected the tail to decay smoothly, but the RMS rose from %f to %f at %d", previous, rms, start)
+		}
+		previous = rms
+	}
+	if math.Abs(wet[len(wet)-1]) > 1e-3 {
+		t.Errorf("Expected the tail to end in silence, got %f", wet[len(wet)-1])
+	}
+}
+
+func TestGainDB(t *testing.T) {
+	if gain := DBToLinear(6); math.Abs(gain-2) > 0.01 {
+		t.Errorf("Expected +6 dB to roughly double the amplitude, got a gain of %f", gain)
+	}
+	if gain := DBToLinear(0); gain != 1 {
+		t.Errorf("Expected 0 dB to give a gain of 1, got %f", gain)
+	}
+	for _, db := range []float64{-96, -20, -6, -0.5, 0, 3, 12} {
+		if roundTrip := LinearToDB(DBToLinear(db)); math.Abs(roundTrip-db) > 1e-9 {
+			t.Errorf("Expected %f dB after the round trip, got %f", db, roundTrip)
+		}
+	}
+	if !math.IsInf(LinearToDB(0), -1) {
+		t.Errorf("Expected negative infinity for a gain of 0, got %f", LinearToDB(0))
+	}
+	samples := []float64{0.25, -0.5, 0}
+	amplified := ApplyGainDB(samples, 6)
+	for i, sample := range samples {
+		if math.Abs(amplified[i]-sample*DBToLinear(6)) > 1e-12 {
+			t.Errorf("Expected %f at %d, got %f", sample*DBToLinear(6), i, amplified[i])
+		}
+	}
+	if samples[0] != 0.25 {
+		t.Error("Expected ApplyGainDB to leave the input unchanged")
+	}
+}
+
+func TestKickTwoStageDecay(t *testing.T) {
+	cfg, err := New808(Kick, nil, 1.0, 44100, 16, 1)
+	if err != nil {
+		t.Fatalf("New808 failed: %v", err)
+	}
+	cfg.Attack = 0.002
+	cfg.Decay = 0.05
+	cfg.DecayStage2Sec = 0.3
+	cfg.DecayStage2Level = 0.4
+	breakpoint := cfg.Attack + cfg.Decay
+	if level := cfg.kickEnvelopeAtTime(breakpoint); math.Abs(level-cfg.DecayStage2Level) > 1e-9 {
+		t.Errorf("Expected the shoulder level %f at the breakpoint, got %f", cfg.DecayStage2Level, level)
+	}
+	// The slope of the level in dB should be steep before the breakpoint and shallow after it
+	slope := func(t0, t1 float64) float64 {
+		return (LinearToDB(cfg.kickEnvelopeAtTime(t1)) - LinearToDB(cfg.kickEnvelopeAtTime(t0))) / (t1 - t0)
+	}
+	fast := slope(cfg.Attack+0.01, breakpoint-0.01)
+	slow := slope(breakpoint+0.01, breakpoint+0.2)
+	if fast > 2*slow {
+		t.Errorf("Expected the first stage (%f dB/s) to fall much faster than the second stage (%f dB/s)", fast, slow)
+	}
+	if expected := -20 / math.Ln10 / cfg.DecayStage2Sec; math.Abs(slow-expected) > 0.01 {
+		t.Errorf("Expected the second stage to fall by %f dB/s, got %f", expected, slow)
+	}
+	samples, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick failed: %v", err)
+	}
+	// The tail should still carry energy, since the second stage decays slowly
+	if rms := rootMeanSquare(samples[len(samples)/2 : len(samples)/2+4410]); rms < 0.01 {
+		t.Errorf("Expected the kick to ring out in the second stage, got an RMS of %f", rms)
+	}
+}
+
+func TestAWeightedRMS(t *testing.T) {
+	const sampleRate = 44100
+	tone := func(freq float64) []float64 {
+		samples := make([]float64, sampleRate)
+		for i := range samples {
+			samples[i] = 0.5 * math.Sin(2*math.Pi*freq*float64(i)/sampleRate)
+		}
+		return samples
+	}
+	// Skip the first 100 ms, where the filters settle
+	level := func(freq float64) float64 {
+		weighted := AWeighting(tone(freq), sampleRate)
+		return LinearToDB(rootMeanSquare(weighted[sampleRate/10:]) / rootMeanSquare(tone(freq)))
+	}
+	if at1k := level(1000); math.Abs(at1k) > 0.1 {
+		t.Errorf("Expected about 0 dB of A-weighting at 1 kHz, got %f dB", at1k)
+	}
+	// The A-weighting curve is at -19.1 dB at 100 Hz
+	if at100 := level(100); math.Abs(at100+19.1) > 0.5 {
+		t.Errorf("Expected about -19.1 dB of A-weighting at 100 Hz, got %f dB", at100)
+	}
+	if AWeightedRMS(tone(100), sampleRate) >= AWeightedRMS(tone(1000), sampleRate) {
+		t.Error("Expected a 100 Hz tone to have a lower A-weighted RMS than a 1 kHz tone of the same amplitude")
+	}
+	if AWeightedRMS(nil, sampleRate) != 0 {
+		t.Error("Expected an A-weighted RMS of 0 for no samples")
+	}
+}
+
+func TestApplyCrossfeed(t *testing.T) {
+	sampleRate := 44100
+	left := createSineWave(200, sampleRate/10, sampleRate)
+	right := make([]float64, len(left))
+	outL, outR := ApplyCrossfeed(left, right, 0.5, sampleRate)
+	if len(outL) != len(left) || len(outR) != len(right) {
+		t.Fatalf("Expected %d samples per channel, got %d and %d", len(left), len(outL), len(outR))
+	}
+	delay := int(crossfeedDelay * float64(sampleRate))
+	for i := 0; i <= delay; i++ {
+		if outR[i] != 0 {
+			t.Fatalf("Expected the leak into the right channel to be delayed by %d samples, got %f at %d", delay, outR[i], i)
+		}
+	}
+	leaked, direct := rootMeanSquare(outR), rootMeanSquare(outL)
+	if leaked == 0 {
+		t.Fatal("Expected the left channel to leak into the right channel")
+	}
+	if leaked >= direct {
+		t.Errorf("Expected the leak (%f) to be quieter than the direct signal (%f)", leaked, direct)
+	}
+	unchangedL, unchangedR := ApplyCrossfeed(left, right, 0, sampleRate)
+	for i := range left {
+		if unchangedL[i] != left[i] || unchangedR[i] != 0 {
+			t.Fatalf("Expected an amount of 0 to leave the channels unchanged, at %d", i)
+		}
+	}
+}
+
+func TestExportVariants(t *testing.T) {
+	cfg := NewRandom(Snare, nil, 44100, 16, 1)
+	cfg.Drive = 1.0
+	variants := []ExportSpec{
+		{SampleRate: 48000, BitDepth: 24, Channels: 2, Suffix: "_48k_24bit"},
+		{SampleRate: 44100, BitDepth: 16, Channels: 1, Suffix: "_44k_16bit"},
+		{SampleRate: 22050, BitDepth: 8, Channels: 1, Suffix: "_22k_8bit"},
+	}
+	dir := t.TempDir()
+	filenames, err := cfg.ExportVariants(variants, dir)
+	if err != nil {
+		t.Fatalf("ExportVariants failed: %v", err)
+	}
+	if len(filenames) != len(variants) {
+		t.Fatalf("Expected %d files, got %d", len(variants), len(filenames))
+	}
+	for i, variant := range variants {
+		if expected := filepath.Join(dir, "snare"+variant.Suffix+".wav"); filenames[i] != expected {
+			t.Errorf("Expected the filename %s, got %s", expected, filenames[i])
+		}
+		f, err := os.Open(filenames[i])
+		if err != nil {
+			t.Fatalf("Could not open the exported file: %v", err)
+		}
+		decoder := wav.NewDecoder(f)
+		decoder.ReadInfo()
+		f.Close()
+		if !decoder.IsValidFile() {
+			t.Fatalf("Expected a valid WAV file: %s", filenames[i])
+		}
+		if int(decoder.SampleRate) != variant.SampleRate || int(decoder.BitDepth) != variant.BitDepth || int(decoder.NumChans) != variant.Channels {
+			t.Errorf("Expected %d Hz, %d bit, %d channels, got %d Hz, %d bit, %d channels", variant.SampleRate, variant.BitDepth, variant.Channels, decoder.SampleRate, decoder.BitDepth, decoder.NumChans)
+		}
+	}
+	if _, err := cfg.ExportVariants(nil, dir); err == nil {
+		t.Error("Expected an error when no variants are given")
+	}
+}
+
+func TestApplyVibrato(t *testing.T) {
+	sampleRate := 44100
+	const (
+		freq  = 440.0
+		rate  = 5.0
+		depth = 1.0
+	)
+	vibrato := ApplyVibrato(createSineWave(freq, sampleRate, sampleRate), rate, depth, sampleRate)
+	// Measure the frequency of each cycle, from the interpolated upward zero crossings
+	var crossings []float64
+	for i := 1; i < len(vibrato); i++ {
+		if vibrato[i-1] < 0 && vibrato[i] >= 0 {
+			crossings = append(crossings, float64(i-1)+vibrato[i-1]/(vibrato[i-1]-vibrato[i]))
+		}
+	}
+	period := float64(sampleRate) / rate
+	highest := freq * math.Pow(2, depth/12)
+	lowest := freq * (2 - math.Pow(2, depth/12))
+	// Each period of the vibrato should go from the lowest to the highest pitch
+	for start := 0.0; start+period <= float64(len(vibrato)); start += period {
+		minFreq, maxFreq := math.Inf(1), 0.0
+		for i := 1; i < len(crossings); i++ {
+			if crossings[i-1] >= start && crossings[i] < start+period {
+				cycleFreq := float64(sampleRate) / (crossings[i] - crossings[i-1])
+				minFreq = math.Min(minFreq, cycleFreq)
+				maxFreq = math.Max(maxFreq, cycleFreq)
+			}
+		}
+		if math.Abs(maxFreq-highest) > 3 || math.Abs(minFreq-lowest) > 3 {
+			t.Errorf("Expected the pitch to range from %.1f to %.1f Hz, got %.1f to %.1f Hz at %.0f", lowest, highest, minFreq, maxFreq, start)
+		}
+	}
+	if unchanged := ApplyVibrato([]float64{0.1, 0.2}, rate, 0, sampleRate); unchanged[1] != 0.2 {
+		t.Error("Expected a depth of 0 to leave the samples unchanged")
+	}
+}
+
+func TestGenerateSnareFlam(t *testing.T) {
+	cfg, err := NewSnareSettings(nil, 44100, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSnareSettings failed: %v", err)
+	}
+	cfg.SoundType = Kick
+	flam, err := cfg.GenerateSnareFlam(0.03)
+	if err != nil {
+		t.Fatalf("GenerateSnareFlam failed: %v", err)
+	}
+	offset := int(0.03 * float64(cfg.SampleRate))
+	window := cfg.SampleRate / 200 // 5 ms
+	if len(flam) < offset+2*window {
+		t.Fatalf("Expected at least %d samples, got %d", offset+2*window, len(flam))
+	}
+	if rootMeanSquare(flam[:window]) == 0 {
+		t.Error("Expected the grace note to start at the beginning")
+	}
+	before := rootMeanSquare(flam[offset-window : offset])
+	after := rootMeanSquare(flam[offset+window : offset+2*window])
+	if after < 1.5*before {
+		t.Errorf("Expected a second onset after %d samples, got an RMS of %f before and %f after", offset, before, after)
+	}
+	grace := FindPeakAmplitude(flam[:offset])
+	main := FindPeakAmplitude(flam[offset : offset+4*window])
+	if grace >= main {
+		t.Errorf("Expected the grace note (%f) to be quieter than the main hit (%f)", grace, main)
+	}
+	if cfg.SoundType != Kick {
+		t.Error("Expected GenerateSnareFlam to leave the settings unchanged")
+	}
+	if _, err := cfg.GenerateSnareFlam(-1); err == nil {
+		t.Error("Expected an error for a negative flam offset")
+	}
+}
+
+func TestPitchDrift(t *testing.T) {
+	cfg, err := NewSettings(nil, 440.0, 440.0, 2.0, 44100, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.SoundType = Lead
+	cfg.Drive = 1.0
+	cfg.PitchDrift = 0.3
+	cfg.WithSeed(7)
+	curve := cfg.pitchDriftCurve(2 * cfg.SampleRate)
+	lowest, highest := math.Inf(1), math.Inf(-1)
+	for i, drift := range curve {
+		if math.Abs(drift) > cfg.PitchDrift {
+			t.Fatalf("Expected the drift to stay within %f semitones, got %f at %d", cfg.PitchDrift, drift, i)
+		}
+		if i > 0 && math.Abs(drift-curve[i-1]) > 1e-4 {
+			t.Fatalf("Expected the drift to be slow, but it jumped from %f to %f at %d", curve[i-1], drift, i)
+		}
+		lowest, highest = math.Min(lowest, drift), math.Max(highest, drift)
+	}
+	if highest-lowest < cfg.PitchDrift/4 {
+		t.Errorf("Expected the pitch to wander, but it only moved between %f and %f semitones", lowest, highest)
+	}
+	again := cfg.pitchDriftCurve(len(curve))
+	for i := range curve {
+		if curve[i] != again[i] {
+			t.Fatalf("Expected the same drift for the same seed, at %d", i)
+		}
+	}
+	drifting, err := cfg.GenerateLead()
+	if err != nil {
+		t.Fatalf("GenerateLead failed: %v", err)
+	}
+	cfg.PitchDrift = 0
+	steady, err := cfg.GenerateLead()
+	if err != nil {
+		t.Fatalf("GenerateLead failed: %v", err)
+	}
+	if len(drifting) != len(steady) {
+		t.Fatalf("Expected the same length with and without drift, got %d and %d", len(drifting), len(steady))
+	}
+	if correlation(drifting, steady) > 0.99 {
+		t.Error("Expected the pitch drift to change the lead")
+	}
+}
+
+func TestOscillatorWaveforms(t *testing.T) {
+	render := func(waveforms ...int) []float64 {
+		cfg, err := NewSettings(nil, 100.0, 100.0, 0.25, 8000, 16, 1)
+		if err != nil {
+			t.Fatalf("NewSettings failed: %v", err)
+		}
+		cfg.SoundType = Kick
+		cfg.Attack, cfg.Decay, cfg.Sustain, cfg.Release = 0, 0, 1, 0
+		cfg.Drive = 0
+		cfg.NoLimiter = true
+		cfg.NumOscillators = 2
+		cfg.OscillatorLevels = []float64{1, 1}
+		cfg.OscillatorWaveforms = waveforms
+		samples, err := cfg.GenerateKick()
+		if err != nil {
+			t.Fatalf("GenerateKick failed: %v", err)
+		}
+		return samples
+	}
+	sines := render(WaveSine, WaveSine)
+	layered := render(WaveSine, WaveSawtooth)
+	if peak := peakFrequency(layered, 8000); math.Abs(peak-100) > 5 {
+		t.Errorf("Expected a clean fundamental at 100 Hz, got a peak at %f Hz", peak)
+	}
+	sineHarmonics := bandEnergy(sines, 180, 420, 8000)
+	sawHarmonics := bandEnergy(layered, 180, 420, 8000)
+	if sawHarmonics < 100*sineHarmonics {
+		t.Errorf("Expected the saw to add harmonics, got %f compared to %f for two sines", sawHarmonics, sineHarmonics)
+	}
+	cfg := &Settings{WaveformType: WaveTriangle, OscillatorWaveforms: []int{WaveSine}}
+	if cfg.oscillatorWaveform(0) != WaveSine || cfg.oscillatorWaveform(1) != WaveTriangle {
+		t.Error("Expected the oscillators without a waveform to use the WaveformType")
+	}
+}
+
+func TestDecimate(t *testing.T) {
+	sampleRate := 44100
+	tone := createSineWave(1000, sampleRate/10, sampleRate)
+	held := Decimate(tone, 8, false)
+	interpolated := Decimate(tone, 8, true)
+	if len(held) != len(tone) || len(interpolated) != len(tone) {
+		t.Fatalf("Expected %d samples, got %d and %d", len(tone), len(held), len(interpolated))
+	}
+	for i := 0; i < len(tone); i += 8 {
+		if held[i] != tone[i] || interpolated[i] != tone[i] {
+			t.Fatalf("Expected the kept samples to be unchanged, at %d", i)
+		}
+	}
+	// Everything above the new Nyquist frequency is aliasing
+	nyquist := float64(sampleRate) / 8 / 2
+	heldAliasing := bandEnergy(held, nyquist, float64(sampleRate)/2, sampleRate)
+	interpolatedAliasing := bandEnergy(interpolated, nyquist, float64(sampleRate)/2, sampleRate)
+	if interpolatedAliasing >= heldAliasing/2 {
+		t.Errorf("Expected less aliasing with interpolation, got %f compared to %f", interpolatedAliasing, heldAliasing)
+	}
+	unchanged := Decimate(tone, 1, true)
+	for i := range tone {
+		if unchanged[i] != tone[i] {
+			t.Fatalf("Expected a factor of 1 to leave the samples unchanged, at %d", i)
+		}
+	}
+}
+
+func TestAutoLevel(t *testing.T) {
+	sampleRate := 8000
+	samples := createSineWave(200, 4*sampleRate, sampleRate)
+	for i := range samples {
+		if i < len(samples)/2 {
+			samples[i] *= 0.8
+		} else {
+			samples[i] *= 0.1
+		}
+	}
+	// A short burst in the quiet half
+	burst := 3 * sampleRate
+	for i := burst; i < burst+40; i++ {
+		samples[i] = 0.5
+	}
+	leveled := AutoLevel(samples, 0.3, 0.2, sampleRate)
+	if len(leveled) != len(samples) {
+		t.Fatalf("Expected %d samples, got %d", len(samples), len(leveled))
+	}
+	loud := rootMeanSquare(leveled[sampleRate/2 : 3*sampleRate/2])
+	quiet := rootMeanSquare(leveled[5*sampleRate/2 : 2*sampleRate+3*sampleRate/4])
+	originalRatio := rootMeanSquare(samples[sampleRate/2:3*sampleRate/2]) / rootMeanSquare(samples[5*sampleRate/2:2*sampleRate+3*sampleRate/4])
+	if ratio := loud / quiet; ratio > originalRatio/3 {
+		t.Errorf("Expected more uniform RMS levels, got a ratio of %f (originally %f)", ratio, originalRatio)
+	}
+	if math.Abs(loud-0.3) > 0.05 {
+		t.Errorf("Expected an RMS level close to 0.3, got %f", loud)
+	}
+	// The burst should still stand out from the quiet part around it
+	around := rootMeanSquare(leveled[burst-sampleRate/4 : burst-sampleRate/8])
+	if peak := FindPeakAmplitude(leveled[burst : burst+40]); peak < 3*around {
+		t.Errorf("Expected the transient to be preserved, got a peak of %f compared to an RMS of %f around it", peak, around)
+	}
+}
+
+func TestClapDrift(t *testing.T) {
+	cfg, err := NewClapSettings(nil, 44100, 16, 1)
+	if err != nil {
+		t.Fatalf("NewClapSettings failed: %v", err)
+	}
+	cfg.WithSeed(3)
+	gains, cutoffs := cfg.clapBurstDrift(3)
+	for burst := range gains {
+		if gains[burst] != 1 || cutoffs[burst] != cfg.FilterCutoff {
+			t.Errorf("Expected uniform bursts without drift, got a gain of %f and a cutoff of %f for burst %d", gains[burst], cutoffs[burst], burst)
+		}
+	}
+	cfg.ClapDrift = 0.2
+	gains, cutoffs = cfg.clapBurstDrift(3)
+	if gains[0] == gains[1] && gains[1] == gains[2] {
+		t.Errorf("Expected the burst levels to differ with drift, got %v", gains)
+	}
+	for burst := range gains {
+		if math.Abs(gains[burst]-1) > cfg.ClapDrift {
+			t.Errorf("Expected the gain of burst %d to be within %f of 1, got %f", burst, cfg.ClapDrift, gains[burst])
+		}
+		if octaves := math.Abs(math.Log2(cutoffs[burst] / cfg.FilterCutoff)); octaves > cfg.ClapDrift {
+			t.Errorf("Expected the cutoff of burst %d to be within %f octaves, got %f", burst, cfg.ClapDrift, octaves)
+		}
+	}
+	again, _ := cfg.clapBurstDrift(3)
+	for burst := range gains {
+		if gains[burst] != again[burst] {
+			t.Error("Expected the same drift for the same seed")
+		}
+	}
+	// Without UseSeed, the drift follows the same rule as the noise, and is different each time
+	cfg.UseSeed = false
+	first, _ := cfg.clapBurstDrift(3)
+	second, _ := cfg.clapBurstDrift(3)
+	if first[0] == second[0] && first[1] == second[1] && first[2] == second[2] {
+		t.Error("Expected a different drift each time when UseSeed is not set")
+	}
+	if _, err := cfg.GenerateClap(); err != nil {
+		t.Fatalf("GenerateClap failed: %v", err)
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	samples := []float64{0, 0.5, -0.25, 1}
+	var buf strings.Builder
+	if err := ExportCSV(&buf, samples, 4); err != nil {
+		t.Fatalf("ExportCSV failed: %v", err)
+	}
+	rows := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(rows) != len(samples)+1 {
+		t.Fatalf("Expected %d rows, including the header, got %d", len(samples)+1, len(rows))
+	}
+	if rows[0] != "time,amplitude" {
+		t.Errorf("Expected the header time,amplitude, got %s", rows[0])
+	}
+	if rows[1] != "0,0" {
+		t.Errorf("Expected the first row to start at time 0, got %s", rows[1])
+	}
+	if rows[3] != "0.5,-0.25" {
+		t.Errorf("Expected the row 0.5,-0.25, got %s", rows[3])
+	}
+	if err := ExportCSV(&buf, samples, 0); err == nil {
+		t.Error("Expected an error for a sample rate of 0")
+	}
+}
+
+func TestRawPCM(t *testing.T) {
+	samples := []float64{0, 0.5, -0.5, 1, -1, 0.123, -0.987, 0.25}
+	var buf bytes.Buffer
+	if err := SaveRawPCM(&buf, samples, 16); err != nil {
+		t.Fatalf("SaveRawPCM failed: %v", err)
+	}
+	if buf.Len() != 2*len(samples) {
+		t.Fatalf("Expected %d bytes, got %d", 2*len(samples), buf.Len())
+	}
+	loaded, err := LoadRawPCM(&buf, 16, 2, true)
+	if err != nil {
+		t.Fatalf("LoadRawPCM failed: %v", err)
+	}
+	if len(loaded) != len(samples) {
+		t.Fatalf("Expected %d samples, got %d", len(samples), len(loaded))
+	}
+	for i := range samples {
+		if math.Abs(loaded[i]-samples[i]) > 1.0/16384 {
+			t.Errorf("Expected %f at %d, got %f", samples[i], i, loaded[i])
+		}
+	}
+	// 0x1234 as big-endian, and -2 as little-endian
+	bigEndian, err := LoadRawPCM(bytes.NewReader([]byte{0x12, 0x34}), 16, 1, false)
+	if err != nil || bigEndian[0] != float64(0x1234)/32768 {
+		t.Errorf("Expected a big-endian sample of %f, got %v (%v)", float64(0x1234)/32768, bigEndian, err)
+	}
+	negative, err := LoadRawPCM(bytes.NewReader([]byte{0xfe, 0xff, 0xff}), 24, 1, true)
+	if err != nil || negative[0] != -2.0/(1<<23) {
+		t.Errorf("Expected a 24-bit sample of %g, got %v (%v)", -2.0/(1<<23), negative, err)
+	}
+	if _, err := LoadRawPCM(bytes.NewReader([]byte{1, 2, 3}), 16, 1, true); err == nil {
+		t.Error("Expected an error for a partial frame")
+	}
+	if err := SaveRawPCM(&buf, samples, 12); err == nil {
+		t.Error("Expected an error for a bit depth of 12")
+	}
+}
+
+func TestApplyWrapperValidation(t *testing.T) {
+	samples := createSineWave(440, 800, 8000)
+	if _, err := ApplyReverb(samples, 8000, []float64{0.03, 0.05}, []float64{0.5}, 0.3); err == nil {
+		t.Error("Expected an error from ApplyReverb when the delay times and decays differ in length")
+	}
+	if _, err := ApplyReverb(samples, 0, nil, nil, 0.3); err == nil {
+		t.Error("Expected an error from ApplyReverb for a sample rate of 0")
+	}
+	if reverbed, err := ApplyReverb(samples, 8000, []float64{0.03}, []float64{0.5}, 0.3); err != nil || len(reverbed) != len(samples) {
+		t.Errorf("Expected ApplyReverb to succeed, got %d samples and the error %v", len(reverbed), err)
+	}
+	if _, err := ApplyReverbAutomated(samples, 8000, []float64{0.03}, nil, nil); err == nil {
+		t.Error("Expected an error from ApplyReverbAutomated when the delay times and decays differ in length")
+	}
+	if _, err := ApplySidechainCompressor(samples, samples[:400], 0.5, 4, 0.01, 0.1, 8000); err == nil {
+		t.Error("Expected an error from ApplySidechainCompressor when the target and trigger differ in length")
+	}
+	if compressed, err := ApplySidechainCompressor(samples, samples, 0.5, 4, 0.01, 0.1, 8000); err != nil || len(compressed) != len(samples) {
+		t.Errorf("Expected ApplySidechainCompressor to succeed, got %d samples and the error %v", len(compressed), err)
+	}
+	bands := []struct {
+		Low  float64
+		High float64
+	}{{20, 200}, {200, 2000}}
+	compressors := []struct {
+		Threshold float64
+		Ratio     float64
+		Attack    float64
+		Release   float64
+	}{{0.5, 4, 0.01, 0.1}}
+	if _, err := ApplyMultibandCompression(samples, bands, compressors, 8000); err == nil {
+		t.Error("Expected an error from ApplyMultibandCompression when the bands and compressors differ in length")
+	}
+	if _, err := ApplyMultibandCompression(samples, bands[:1], compressors, 8000); err != nil {
+		t.Errorf("Expected ApplyMultibandCompression to succeed, got the error %v", err)
+	}
+}
+
+func TestDeClick(t *testing.T) {
+	sampleRate := 44100
+	samples := createSineWave(200, sampleRate/10, sampleRate)
+	seam := len(samples) / 2
+	for i := seam; i < len(samples); i++ {
+		samples[i] += 0.5 // an abrupt step
+	}
+	// The largest second difference around the seam, which is where a click is heard
+	click := func(samples []float64) float64 {
+		largest := 0.0
+		for i := seam - 200; i < seam+200; i++ {
+			largest = math.Max(largest, math.Abs(samples[i]-2*samples[i-1]+samples[i-2]))
+		}
+		return largest
+	}
+	if before := click(samples); before < 0.4 {
+		t.Fatalf("Expected a click in the test signal, got %f", before)
+	}
+	declicked := DeClick(samples, []int{seam}, 64)
+	if after := click(declicked); after > 0.005 {
+		t.Errorf("Expected the click to be smoothed out, got a second difference of %f", after)
+	}
+	for _, i := range []int{0, seam - 100, seam + 100, len(samples) - 1} {
+		if declicked[i] != samples[i] {
+			t.Errorf("Expected the samples outside of the window to be unchanged, at %d", i)
+		}
+	}
+}
+
+func TestSpeakerSim(t *testing.T) {
+	sampleRate := 44100
+	gain := func(freq float64) float64 {
+		tone := createSineWave(freq, sampleRate/2, sampleRate)
+		simulated := SpeakerSim(tone, sampleRate)
+		// Skip the first 100 ms, where the filters settle
+		return LinearToDB(rootMeanSquare(simulated[sampleRate/10:]) / rootMeanSquare(tone[sampleRate/10:]))
+	}
+	if low := gain(60); low > -20 {
+		t.Errorf("Expected 60 Hz to be strongly attenuated, got %f dB", low)
+	}
+	if mid := gain(1500); math.Abs(mid-4) > 1.5 {
+		t.Errorf("Expected a bump of about 4 dB at 1.5 kHz, got %f dB", mid)
+	}
+	if high := gain(12000); high > -10 {
+		t.Errorf("Expected 12 kHz to be rolled off, got %f dB", high)
+	}
+}
+
+func TestRenderSequence(t *testing.T) {
+	var cfgs []*Settings
+	for _, soundType := range []SoundType{Kick, Snare, Kick} {
+		cfg, err := New808(soundType, nil, 0.2, 8000, 16, 1)
+		if err != nil {
+			t.Fatalf("New808 failed: %v", err)
+		}
+		cfg.Drive = 1.0
+		cfgs = append(cfgs, cfg)
+	}
+	sequence, err := RenderSequence(cfgs, 0.1)
+	if err != nil {
+		t.Fatalf("RenderSequence failed: %v", err)
+	}
+	if expected := 3 * (1600 + 800); len(sequence) != expected {
+		t.Fatalf("Expected %d samples, got %d", expected, len(sequence))
+	}
+	// Count the transients, as the times the level of 5 ms windows rises from silence
+	window := 40
+	transients, silent := 0, true
+	for start := 0; start+window <= len(sequence); start += window {
+		rms := rootMeanSquare(sequence[start : start+window])
+		if silent && rms > 0.05 {
+			transients++
+		}
+		silent = rms < 0.001
+	}
+	if transients != len(cfgs) {
+		t.Errorf("Expected %d transients, got %d", len(cfgs), transients)
+	}
+	if _, err := RenderSequence(nil, 0.1); err == nil {
+		t.Error("Expected an error when there are no settings")
+	}
+}
+
+func TestApplyInharmonicity(t *testing.T) {
+	partials := []float64{1, 1.0, 2, 0.5, 3, 0.33, 4, 0.25, 5, 0.2}
+	stretched := ApplyInharmonicity(partials, 1.01)
+	if len(stretched) != len(partials) {
+		t.Fatalf("Expected %d values, got %d", len(partials), len(stretched))
+	}
+	if stretched[0] != 1 {
+		t.Errorf("Expected the fundamental to stay at 1, got %f", stretched[0])
+	}
+	previousCents := 0.0
+	for j := 2; j < len(partials); j += 2 {
+		if stretched[j+1] != partials[j+1] {
+			t.Errorf("Expected the amplitude of partial %d to be unchanged, got %f", j/2+1, stretched[j+1])
+		}
+		cents := 1200 * math.Log2(stretched[j]/partials[j])
+		if cents <= previousCents {
+			t.Errorf("Expected partial %d to be sharper than the one below it, got %f cents compared to %f", j/2+1, cents, previousCents)
+		}
+		previousCents = cents
+	}
+	harmonic := ApplyInharmonicity(partials, 1)
+	for j := range partials {
+		if harmonic[j] != partials[j] {
+			t.Errorf("Expected a stretch factor of 1 to leave the partials unchanged, at %d", j)
+		}
+	}
+	if tone := ApplyAddPartials(0.1, 0.5, 220, stretched, []float64{1, 1}, 8000); len(tone) != 800 {
+		t.Errorf("Expected 800 samples from the stretched partials, got %d", len(tone))
+	}
+}
+
+func TestNormalizePercentile(t *testing.T) {
+	samples := createSineWave(200, 8000, 8000)
+	for i := range samples {
+		samples[i] *= 0.1
+	}
+	samples[4000] = 1.0 // a lone spike
+	if peakNormalized := NormalizeSamples(samples, 0.9); FindPeakAmplitude(peakNormalized[:3000]) > 0.1 {
+		t.Fatal("Expected the spike to hold back peak normalization")
+	}
+	normalized := NormalizePercentile(samples, 99, 0.9)
+	if peak := FindPeakAmplitude(normalized[:3000]); peak < 0.85 || peak > 0.95 {
+		t.Errorf("Expected the bulk of the signal to reach a peak of about 0.9, got %f", peak)
+	}
+	if normalized[4000] != 1 {
+		t.Errorf("Expected the spike to be clamped to 1, got %f", normalized[4000])
+	}
+	if silent := NormalizePercentile(make([]float64, 10), 99, 0.9); FindPeakAmplitude(silent) != 0 {
+		t.Error("Expected silence to stay silent")
+	}
+}
+
+func TestRepairClicks(t *testing.T) {
+	samples := createSineWave(300, 4000, 44100)
+	for i := range samples {
+		samples[i] *= 0.5
+	}
+	glitched := append([]float64(nil), samples...)
+	glitched[2000] = 0.95
+	repaired := RepairClicks(glitched, 10)
+	if diff := math.Abs(repaired[2000] - samples[2000]); diff > 1e-3 {
+		t.Errorf("Expected the spike to be removed, got %f instead of %f", repaired[2000], samples[2000])
+	}
+	for i := range samples {
+		if i != 2000 && repaired[i] != samples[i] {
+			t.Errorf("Expected the sample at %d to be unchanged, got %f instead of %f", i, repaired[i], samples[i])
+		}
+	}
+}
+
+func TestClickSource(t *testing.T) {
+	cfg, err := New909(Kick, nil, 0.5, 44100, 16, 1)
+	if err != nil {
+		t.Fatalf("New909 failed: %v", err)
+	}
+	cfg.ClickSource = ClickNone
+	if click := cfg.kickClick(1000); FindPeakAmplitude(click) != 0 {
+		t.Error("Expected no click without a click source")
+	}
+	// The high frequency content of the clicks, above the square click frequency
+	highs := make(map[int]float64)
+	for _, source := range []int{ClickNoise, ClickSquare, ClickSine} {
+		cfg.ClickSource = source
+		click := cfg.kickClick(cfg.SampleRate)
+		if len(click) != int(clickDuration*float64(cfg.SampleRate)) {
+			t.Fatalf("Expected a click of %d samples, got %d", int(clickDuration*float64(cfg.SampleRate)), len(click))
+		}
+		highs[source] = bandEnergy(click, 5000, 22050, cfg.SampleRate) / bandEnergy(click, 0, 22050, cfg.SampleRate)
+	}
+	if !(highs[ClickNoise] > highs[ClickSquare] && highs[ClickSquare] > highs[ClickSine]) {
+		t.Errorf("Expected noise to have more high frequency content than square, and square more than sine, got %v", highs)
+	}
+	withClick, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick failed: %v", err)
+	}
+	cfg.ClickSource = ClickNone
+	withoutClick, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick failed: %v", err)
+	}
+	if correlation(withClick[:100], withoutClick[:100]) > 0.99 {
+		t.Error("Expected the click to change the attack of the kick")
+	}
+}
+
+func TestServeWav(t *testing.T) {
+	samples := createSineWave(440, 800, 8000)
+	recorder := httptest.NewRecorder()
+	ServeWav(samples, 8000, 16, 1)(recorder, httptest.NewRequest(http.MethodGet, "/preview.wav", nil))
+	response := recorder.Result()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", response.StatusCode)
+	}
+	if contentType := response.Header.Get("Content-Type"); contentType != "audio/wav" {
+		t.Errorf("Expected the content type audio/wav, got %s", contentType)
+	}
+	body := recorder.Body.Bytes()
+	if contentLength := response.Header.Get("Content-Length"); contentLength != strconv.Itoa(len(body)) {
+		t.Errorf("Expected the content length %d, got %s", len(body), contentLength)
+	}
+	decoder := wav.NewDecoder(bytes.NewReader(body))
+	if !decoder.IsValidFile() {
+		t.Fatal("Expected a valid WAV file")
+	}
+	if decoder.SampleRate != 8000 || decoder.BitDepth != 16 || decoder.NumChans != 1 {
+		t.Errorf("Expected 8000 Hz, 16 bit and 1 channel, got %d Hz, %d bit and %d channels", decoder.SampleRate, decoder.BitDepth, decoder.NumChans)
+	}
+	recorder = httptest.NewRecorder()
+	ServeWav(nil, 8000, 16, 1)(recorder, httptest.NewRequest(http.MethodGet, "/preview.wav", nil))
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 for no samples, got %d", recorder.Code)
+	}
+}
+
+func TestRetroMode(t *testing.T) {
+	cfg, err := New808(Kick, nil, 0.3, 44100, 16, 1)
+	if err != nil {
+		t.Fatalf("New808 failed: %v", err)
+	}
+	cfg.RetroMode = true
+	samples, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick failed: %v", err)
+	}
+	levels := make(map[float64]bool)
+	repeated := 0
+	for i, sample := range samples {
+		if steps := sample * 127; math.Abs(steps-math.Round(steps)) > 1e-9 {
+			t.Fatalf("Expected the samples to be quantized to 8 bits, got %f at %d", sample, i)
+		}
+		levels[sample] = true
+		if i > 0 && sample == samples[i-1] {
+			repeated++
+		}
+	}
+	if len(levels) > 255 {
+		t.Errorf("Expected at most 255 levels, got %d", len(levels))
+	}
+	// The quantization steps show up as runs of repeated values in the waveform
+	if repeated < len(samples)/10 {
+		t.Errorf("Expected visible quantization steps, but only %d of %d samples repeat the previous value", repeated, len(samples))
+	}
+}
+
+func TestRetroModeOscillators(t *testing.T) {
+	cfg, err := NewSettings(nil, 440.0, 110.0, 0.1, 44100, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.RetroMode = true
+	cfg.SmoothFrequencyTransitions = true
+	// The sweep is the raw oscillator output, without any envelope or post-processing
+	for _, waveform := range []int{WaveSine, WaveTriangle, WaveSawtooth, WaveSquare} {
+		cfg.WaveformType = waveform
+		samples, err := cfg.GenerateSweepWaveform()
+		if err != nil {
+			t.Fatalf("GenerateSweepWaveform failed: %v", err)
+		}
+		for i, sample := range samples {
+			if steps := sample * 127; math.Abs(steps-math.Round(steps)) > 1e-9 {
+				t.Fatalf("Expected waveform %d to be quantized to 8 bits while generated, got %f at %d", waveform, sample, i)
+			}
+		}
+		for phase := 0.0; phase < 1; phase += 0.01 {
+			if steps := cfg.oscillatorValue(waveform, phase) * 127; math.Abs(steps-math.Round(steps)) > 1e-9 {
+				t.Fatalf("Expected the oscillator value of waveform %d to be quantized to 8 bits at phase %f", waveform, phase)
+			}
+		}
+	}
+	// The frequency sweep is not smoothed
+	frequencies := cfg.frequencyTrajectory(100)
+	for i, frequency := range frequencies {
+		if want := cfg.sweepFrequency(float64(i) / float64(cfg.SampleRate)); frequency != want {
+			t.Fatalf("Expected an unsmoothed frequency of %f Hz at %d, got %f Hz", want, i, frequency)
+		}
+	}
+	cfg.RetroMode = false
+	cfg.WaveformType = WaveSine
+	samples, err := cfg.GenerateSweepWaveform()
+	if err != nil {
+		t.Fatalf("GenerateSweepWaveform failed: %v", err)
+	}
+	quantized := true
+	for _, sample := range samples {
+		if steps := sample * 127; math.Abs(steps-math.Round(steps)) > 1e-9 {
+			quantized = false
+			break
+		}
+	}
+	if quantized {
+		t.Error("Expected the oscillator not to be quantized without RetroMode")
+	}
+}
+
+func TestOscillatorPans(t *testing.T) {
+	cfg, err := NewSettings(nil, 100.0, 60.0, 0.3, 8000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.SoundType = Kick
+	cfg.Drive = 0
+	cfg.NumOscillators = 2
+	cfg.OscillatorLevels = []float64{1, 1}
+	cfg.OscillatorWaveforms = []int{WaveSine, WaveSawtooth}
+	cfg.OscillatorPans = []float64{-1, 1}
+	left, right, err := cfg.GenerateKickStereo()
+	if err != nil {
+		t.Fatalf("GenerateKickStereo failed: %v", err)
+	}
+	if len(left) != len(right) {
+		t.Fatalf("Expected channels of the same length, got %d and %d", len(left), len(right))
+	}
+	if c := correlation(left, right); c > 0.9 {
+		t.Errorf("Expected hard panned oscillators to give decorrelated channels, got a correlation of %f", c)
+	}
+	cfg.OscillatorPans = nil
+	left, right, err = cfg.GenerateKickStereo()
+	if err != nil {
+		t.Fatalf("GenerateKickStereo failed: %v", err)
+	}
+	for i := range left {
+		if left[i] != right[i] {
+			t.Fatalf("Expected centered oscillators to give identical channels, at %d", i)
+		}
+	}
+}
+
+func TestIncludeReleaseTail(t *testing.T) {
+	cfg, err := NewSettings(nil, 440.0, 440.0, 0.2, 8000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.SoundType = Bass
+	cfg.Drive = 1.0
+	cfg.Attack, cfg.Decay, cfg.Sustain, cfg.Release = 0.01, 0.05, 0.6, 0.3
+	truncated, err := cfg.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if len(truncated) != 1600 {
+		t.Fatalf("Expected %d samples without the release tail, got %d", 1600, len(truncated))
+	}
+	cfg.IncludeReleaseTail = true
+	extended, err := cfg.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if expected := int(0.36 * 8000); len(extended) != expected {
+		t.Errorf("Expected %d samples with the release tail, got %d", expected, len(extended))
+	}
+	if cfg.Duration != 0.2 {
+		t.Errorf("Expected the duration in the settings to be unchanged, got %f", cfg.Duration)
+	}
+	cfg.Duration = 1.0
+	if samples, err := cfg.Generate(); err != nil || len(samples) != 8000 {
+		t.Errorf("Expected the duration to be kept when the release fits, got %d samples (%v)", len(samples), err)
+	}
+}
+
+func TestFilterFM(t *testing.T) {
+	render := func(amount float64) []float64 {
+		cfg, err := NewSettings(nil, 100.0, 100.0, 0.5, 8000, 16, 1)
+		if err != nil {
+			t.Fatalf("NewSettings failed: %v", err)
+		}
+		cfg.SoundType = Bass
+		cfg.Attack, cfg.Decay, cfg.Sustain, cfg.Release = 0, 0, 1, 0
+		cfg.Drive = 1.0
+		cfg.NoLimiter = true
+		cfg.FadeDuration = 0
+		cfg.FilterCutoff = 500
+		cfg.FilterResonance = 4
+		cfg.OscillatorWaveforms = []int{WaveSawtooth}
+		cfg.FilterFMAmount = amount
+		samples, err := cfg.GenerateBass()
+		if err != nil {
+			t.Fatalf("GenerateBass failed: %v", err)
+		}
+		return samples[2000:]
+	}
+	// The energy in the sidebands above the resonant peak, compared to the energy of the whole sound
+	sidebands := func(samples []float64) float64 {
+		return bandEnergy(samples, 750, 4000, 8000) / bandEnergy(samples, 0, 4000, 8000)
+	}
+	plain := sidebands(render(1e-9))
+	modulated := sidebands(render(1))
+	if modulated < 10*plain {
+		t.Errorf("Expected filter FM to add sidebands around the resonant peak, got %f compared to %f", modulated, plain)
+	}
+}
+
+func TestSoftStart(t *testing.T) {
+	cfg, err := NewSettings(nil, 200.0, 200.0, 0.1, 44100, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.SoundType = Kick
+	cfg.WaveformType = WaveSquare
+	cfg.Attack = 0
+	clicking, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick failed: %v", err)
+	}
+	if clicking[0] == 0 {
+		t.Fatal("Expected the square wave kick to start at a non-zero level")
+	}
+	cfg.SoftStart = true
+	samples, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick failed: %v", err)
+	}
+	if samples[0] != 0 {
+		t.Errorf("Expected the first sample to be 0, got %f", samples[0])
+	}
+	fadeSamples := int(softStartDuration * float64(cfg.SampleRate))
+	reference := softStart(createTestWaveform(1, 2*fadeSamples), cfg.SampleRate)
+	for i := 1; i < len(reference); i++ {
+		if reference[i] < reference[i-1] {
+			t.Fatalf("Expected the micro fade-in to ramp up, but it fell at %d", i)
+		}
+	}
+	if reference[fadeSamples/2] <= 0 || reference[fadeSamples/2] >= 1 {
+		t.Errorf("Expected the level to be between 0 and 1 in the middle of the micro fade-in, got %f", reference[fadeSamples/2])
+	}
+	if reference[fadeSamples] != 1 {
+		t.Errorf("Expected the micro fade-in to be done after %d samples, got a level of %f", fadeSamples, reference[fadeSamples])
+	}
+}
+
+func TestMixInto(t *testing.T) {
+	mix := make([]float64, 20) // 10 stereo frames
+	for i := range mix {
+		mix[i] = 0.1
+	}
+	hit := []float64{1, 0.5}
+	mix = MixInto(mix, hit, 4, 2, 0.5, -1)
+	if len(mix) != 20 {
+		t.Fatalf("Expected the length to stay at 20, got %d", len(mix))
+	}
+	// Panned hard left, so only the left channel of frames 4 and 5 should change
+	expected := map[int]float64{8: 0.6, 9: 0.1, 10: 0.35, 11: 0.1}
+	for i, value := range expected {
+		if math.Abs(mix[i]-value) > 1e-12 {
+			t.Errorf("Expected %f at %d, got %f", value, i, mix[i])
+		}
+	}
+	if mix[7] != 0.1 || mix[12] != 0.1 {
+		t.Error("Expected the samples outside of the hit to be unchanged")
+	}
+	// Centered, and extending the destination
+	mix = MixInto(mix, hit, 9, 2, 1, 0)
+	if len(mix) != 22 {
+		t.Fatalf("Expected the destination to be extended to 22 samples, got %d", len(mix))
+	}
+	if math.Abs(mix[18]-(0.1+math.Sqrt2/2)) > 1e-12 || math.Abs(mix[19]-(0.1+math.Sqrt2/2)) > 1e-12 {
+		t.Errorf("Expected a centered hit at -3 dB in both channels, got %f and %f", mix[18], mix[19])
+	}
+	if math.Abs(mix[21]-0.5*math.Sqrt2/2) > 1e-12 {
+		t.Errorf("Expected %f in the extended part, got %f", 0.5*math.Sqrt2/2, mix[21])
+	}
+	if mono := MixInto(nil, hit, 2, 1, 2, 0.5); len(mono) != 4 || mono[2] != 2 || mono[3] != 1 {
+		t.Errorf("Expected the mono mix [0 0 2 1], got %v", mono)
+	}
+}
+
+func TestWithSeed(t *testing.T) {
+	generateSnare := func(seed int64) []float64 {
+		cfg, err := New808(Snare, nil, 0.2, 44100, 16, 1)
+		if err != nil {
+			t.Fatalf("New808 failed: %v", err)
+		}
+		samples, err := cfg.WithSeed(seed).GenerateSnare()
+		if err != nil {
+			t.Fatalf("GenerateSnare failed: %v", err)
+		}
+		return samples
+	}
+	first, second := generateSnare(42), generateSnare(42)
+	if len(first) != len(second) {
+		t.Fatalf("Expected snares of equal length, got %d and %d", len(first), len(second))
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Expected bit-identical snares, but sample %d differs: %v != %v", i, first[i], second[i])
+		}
+	}
+	other := generateSnare(43)
+	identical := true
+	for i := range first {
+		if first[i] != other[i] {
+			identical = false
+			break
+		}
+	}
+	if identical {
+		t.Errorf("Expected a different seed to give a different snare")
+	}
+}
+
+func TestApplyStereoRotation(t *testing.T) {
+	left := []float64{0.5, -0.25, 1.0, 0.0}
+	right := []float64{-0.75, 0.5, 0.0, 0.3}
+	outL, outR := ApplyStereoRotation(left, right, 0)
+	for i := range left {
+		if outL[i] != left[i] || outR[i] != right[i] {
+			t.Errorf("Expected a 0° rotation to leave sample %d unchanged, got %v, %v", i, outL[i], outR[i])
+		}
+	}
+	outL, outR = ApplyStereoRotation(left, right, 90)
+	for i := range left {
+		if math.Abs(outL[i]-right[i]) > 1e-12 || math.Abs(outR[i]-left[i]) > 1e-12 {
+			t.Errorf("Expected a 90° rotation to swap sample %d, got %v, %v", i, outL[i], outR[i])
+		}
+	}
+	outL, outR = ApplyStereoRotation(left, right, 45)
+	for i := range left {
+		if math.Abs(outL[i]-outR[i]) > 1e-12 {
+			t.Errorf("Expected a 45° rotation to center sample %d, got %v, %v", i, outL[i], outR[i])
+		}
+	}
+}
+
+func TestWarpToBars(t *testing.T) {
+	sampleRate := 8000
+	// One bar at 120 BPM is two seconds long
+	loop := createSineWave(440, 2*sampleRate, sampleRate)
+	warped := WarpToBars(loop, 120, 140, sampleRate)
+	if expected := len(loop) * 120 / 140; len(warped) != expected {
+		t.Fatalf("Expected %d samples, got %d", expected, len(warped))
+	}
+	middle := len(warped)/2 - 512
+	if peak := peakFrequency(warped[middle:middle+1024], sampleRate); math.Abs(peak-440) > 10 {
+		t.Errorf("Expected the dominant pitch to stay at 440 Hz, got %.1f Hz", peak)
+	}
+	if rms := rootMeanSquare(warped[middle : middle+1024]); rms < 0.6 {
+		t.Errorf("Expected the frames to add up in phase, got an RMS of %.3f", rms)
+	}
+}
+
+func TestSweepFrequencyGuard(t *testing.T) {
+	sampleRate := 8000
+	cfg, err := NewSettings(nil, 440, 440, 0.5, sampleRate, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.NoLimiter = true
+	samples, err := cfg.GenerateSweepWaveform()
+	if err != nil {
+		t.Fatalf("GenerateSweepWaveform failed: %v", err)
+	}
+	for i, sample := range samples {
+		if math.IsNaN(sample) {
+			t.Fatalf("Expected no NaN samples, got one at %d", i)
+		}
+	}
+	for _, start := range []int{0, len(samples) - 800} {
+		if peak := peakFrequency(samples[start:start+800], sampleRate); math.Abs(peak-440) > 10 {
+			t.Errorf("Expected a steady 440 Hz tone at sample %d, got %.1f Hz", start, peak)
+		}
+	}
+
+	cfg.StartFreq = 0
+	if _, err := cfg.GenerateSweepWaveform(); err == nil {
+		t.Errorf("Expected an error for a sweep with a start frequency of 0")
+	}
+	if _, err := cfg.GenerateKick(); err == nil {
+		t.Errorf("Expected an error for a kick with a start frequency of 0")
+	}
+}
+
+func TestApplyEarlyReflections(t *testing.T) {
+	sampleRate := 1000
+	samples := make([]float64, 100)
+	samples[0] = 1
+	reflections := []struct{ DelaySec, Gain float64 }{
+		{DelaySec: 0.011, Gain: 0.5},
+		{DelaySec: 0.023, Gain: 0.3},
+	}
+	reflected := ApplyEarlyReflections(samples, sampleRate, reflections)
+	if len(reflected) != len(samples) {
+		t.Fatalf("Expected %d samples, got %d", len(samples), len(reflected))
+	}
+	if reflected[0] != 1 {
+		t.Errorf("Expected the dry impulse to be kept, got %v", reflected[0])
+	}
+	if reflected[11] != 0.5 || reflected[23] != 0.3 {
+		t.Errorf("Expected the reflections 0.5 at 11 and 0.3 at 23, got %v and %v", reflected[11], reflected[23])
+	}
+	sum := 0.0
+	for _, sample := range reflected {
+		sum += math.Abs(sample)
+	}
+	if math.Abs(sum-1.8) > 1e-12 {
+		t.Errorf("Expected only the impulse and the two reflections, got a total of %v", sum)
+	}
+}
+
+func TestMorphingWavetable(t *testing.T) {
+	wavetable := BasicWavetable(64)
+	first, last := wavetable.Tables[0], wavetable.Tables[len(wavetable.Tables)-1]
+	for i := range first {
+		phase := float64(i) / float64(len(first))
+		if got := wavetable.Sample(phase, 0); math.Abs(got-first[i]) > 1e-12 {
+			t.Errorf("Expected position 0 to equal the first table at %d, got %v instead of %v", i, got, first[i])
+		}
+		if got := wavetable.Sample(phase, 1); math.Abs(got-last[i]) > 1e-12 {
+			t.Errorf("Expected position 1 to equal the last table at %d, got %v instead of %v", i, got, last[i])
+		}
+	}
+	// Between two adjacent tables, the value should move smoothly from one table to the other
+	phase := 0.1
+	a, b := wavetable.Sample(phase, 0), wavetable.Sample(phase, 1.0/3)
+	if got := wavetable.Sample(phase, 1.0/6); math.Abs(got-(a+b)/2) > 1e-12 {
+		t.Errorf("Expected the halfway position to be the average %v, got %v", (a+b)/2, got)
+	}
+	prev := a
+	for step := 1; step <= 100; step++ {
+		got := wavetable.Sample(phase, float64(step)/300)
+		if math.Abs(got-prev) > 0.02 {
+			t.Errorf("Expected a smooth morph, but the value jumped from %v to %v at step %d", prev, got, step)
+		}
+		prev = got
+	}
+
+	cfg, err := NewSettings(nil, 220, 220, 0.2, 8000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.Drive = 1
+	cfg.Wavetable = wavetable
+	cfg.WavetableMorphRate = 2
+	samples, err := cfg.GenerateLead()
+	if err != nil {
+		t.Fatalf("GenerateLead failed: %v", err)
+	}
+	if rms := rootMeanSquare(samples); rms == 0 || math.IsNaN(rms) {
+		t.Errorf("Expected a wavetable lead, got an RMS of %v", rms)
+	}
+}
+
+func TestApplySpectralFreeze(t *testing.T) {
+	sampleRate := 8000
+	// A chirp from 300 Hz to 1500 Hz, which has a spectrum that changes all the time
+	chirp := make([]float64, sampleRate)
+	for i := range chirp {
+		t := float64(i) / float64(sampleRate)
+		chirp[i] = 0.5 * math.Sin(2*math.Pi*(300*t+600*t*t))
+	}
+	fftSize := 512
+	frozen := ApplySpectralFreeze(chirp, 0.25, 0.5, fftSize, 128, sampleRate)
+	if expected := len(chirp) + sampleRate/2; len(frozen) != expected {
+		t.Fatalf("Expected %d samples, got %d", expected, len(frozen))
+	}
+	// Compare the windowed spectra at the start and the end of the frozen region
+	freezeStart := sampleRate / 4
+	window := Window(fftSize, WindowHann)
+	a := magnitudeSpectrum(ApplyWindow(frozen[freezeStart+fftSize:freezeStart+2*fftSize], window))
+	b := magnitudeSpectrum(ApplyWindow(frozen[freezeStart+sampleRate/2-2*fftSize:freezeStart+sampleRate/2-fftSize], window))
+	if c := correlation(a, b); c < 0.95 {
+		t.Errorf("Expected a near-static spectrum in the frozen region, got a correlation of %.3f", c)
+	}
+	// The original chirp moves on over the same time span
+	a = magnitudeSpectrum(ApplyWindow(chirp[freezeStart+fftSize:freezeStart+2*fftSize], window))
+	b = magnitudeSpectrum(ApplyWindow(chirp[freezeStart+sampleRate/2-2*fftSize:freezeStart+sampleRate/2-fftSize], window))
+	if c := correlation(a, b); c > 0.5 {
+		t.Errorf("Expected the spectrum of the chirp to change, got a correlation of %.3f", c)
+	}
+	if rms := rootMeanSquare(frozen[freezeStart+fftSize : freezeStart+sampleRate/2-fftSize]); rms < 0.2 {
+		t.Errorf("Expected the frozen sound to be sustained, got an RMS of %.3f", rms)
+	}
+	// Before the freeze, the samples are unchanged
+	for i := 0; i < freezeStart-fftSize; i++ {
+		if frozen[i] != chirp[i] {
+			t.Fatalf("Expected the samples before the freeze to be unchanged, but sample %d differs", i)
+		}
+	}
+}
+
+func TestPresetOutputGain(t *testing.T) {
+	// The loudness of a hit is measured as the highest RMS over 50 ms windows, which does not depend on the duration
+	hitLevel := func(samples []float64) float64 {
+		const window = 2205
+		level := 0.0
+		for i := 0; i+window <= len(samples); i += window / 5 {
+			level = math.Max(level, rootMeanSquare(samples[i:i+window]))
+		}
+		return level
+	}
+	kickCfg, err := New808(Kick, nil, 1.0, 44100, 16, 1)
+	if err != nil {
+		t.Fatalf("New808 failed: %v", err)
+	}
+	snareCfg, err := New909(Snare, nil, 1.0, 44100, 16, 1)
+	if err != nil {
+		t.Fatalf("New909 failed: %v", err)
+	}
+	kick, err := kickCfg.WithSeed(1).Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	snare, err := snareCfg.WithSeed(1).Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	kickDB, snareDB := LinearToDB(hitLevel(kick)), LinearToDB(hitLevel(snare))
+	if math.Abs(kickDB-snareDB) > 1.5 {
+		t.Errorf("Expected the 808 kick and the 909 snare to be within 1.5 dB, got %.1f dB and %.1f dB", kickDB, snareDB)
+	}
+}
+
+func TestPresetOutputGainWithDrive(t *testing.T) {
+	// The 606 snare has an OutputGain above 1, which must not push a driven snare past full scale
+	cfg, err := New606(Snare, nil, 0.3, 44100, 16, 1)
+	if err != nil {
+		t.Fatalf("New606 failed: %v", err)
+	}
+	if cfg.OutputGain <= 1 {
+		t.Fatalf("Expected the 606 snare to have an OutputGain above 1, got %f", cfg.OutputGain)
+	}
+	cfg.Drive = 10
+	samples, err := cfg.WithSeed(1).Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	for i, sample := range samples {
+		if sample < -1 || sample > 1 {
+			t.Fatalf("Expected the samples to stay within [-1, 1], got %f at %d", sample, i)
+		}
+	}
+}
+
+func TestPitchRandomCents(t *testing.T) {
+	sampleRate := 8000
+	// The pitch is estimated from the interpolated rising zero crossings
+	pitch := func(samples []float64) float64 {
+		first, last, count := 0.0, 0.0, 0
+		for i := 1; i < len(samples); i++ {
+			if samples[i-1] < 0 && samples[i] >= 0 {
+				crossing := float64(i-1) + samples[i-1]/(samples[i-1]-samples[i])
+				if count == 0 {
+					first = crossing
+				}
+				last = crossing
+				count++
+			}
+		}
+		return float64(count-1) * float64(sampleRate) / (last - first)
+	}
+	render := func() []float64 {
+		cfg, err := NewSettings(nil, 200, 200, 0.3, sampleRate, 16, 1)
+		if err != nil {
+			t.Fatalf("NewSettings failed: %v", err)
+		}
+		cfg.SoundType = Tom
+		cfg.Drive = 1
+		cfg.PitchRandomCents = 50
+		cfg.WithSeed(7)
+		pitches := make([]float64, 5)
+		for i := range pitches {
+			samples, err := cfg.GenerateTom()
+			if err != nil {
+				t.Fatalf("GenerateTom failed: %v", err)
+			}
+			pitches[i] = pitch(samples)
+		}
+		return pitches
+	}
+	pitches := render()
+	low, high := 200*math.Pow(2, -50.0/1200), 200*math.Pow(2, 50.0/1200)
+	distinct := false
+	for i, p := range pitches {
+		if p < low-0.5 || p > high+0.5 {
+			t.Errorf("Expected hit %d to be within ±50 cents of 200 Hz, got %.2f Hz", i, p)
+		}
+		if i > 0 && math.Abs(p-pitches[i-1]) > 0.1 {
+			distinct = true
+		}
+	}
+	if !distinct {
+		t.Errorf("Expected successive hits to have different pitches, got %v", pitches)
+	}
+	for i, p := range render() {
+		if p != pitches[i] {
+			t.Errorf("Expected the seeded pitches to be reproducible, got %.2f Hz instead of %.2f Hz for hit %d", p, pitches[i], i)
+		}
+	}
+	// A given hit can also be generated directly
+	cfg, err := NewSettings(nil, 200, 200, 0.3, sampleRate, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.Drive = 1
+	cfg.PitchRandomCents = 50
+	cfg.WithSeed(7)
+	samples, err := cfg.GenerateTomHit(3)
+	if err != nil {
+		t.Fatalf("GenerateTomHit failed: %v", err)
+	}
+	if p := pitch(samples); p != pitches[3] {
+		t.Errorf("Expected hit 3 to have the pitch %.2f Hz, got %.2f Hz", pitches[3], p)
+	}
+}
+
+func TestSpectrogramFrames(t *testing.T) {
+	sampleRate := 8000
+	// A sine sweep from 200 Hz to 3000 Hz over one second
+	sweep := make([]float64, sampleRate)
+	for i := range sweep {
+		t := float64(i) / float64(sampleRate)
+		sweep[i] = math.Sin(2 * math.Pi * (200*t + 1400*t*t))
+	}
+	frameSize, hop := 256, 256
+	frames := SpectrogramFrames(sweep, frameSize, hop, sampleRate)
+	if expected := (len(sweep) + hop - 1) / hop; len(frames) != expected {
+		t.Fatalf("Expected %d frames, got %d", expected, len(frames))
+	}
+	peakBin := func(magnitudes []float64) int {
+		peak := 0
+		for k := range magnitudes {
+			if magnitudes[k] > magnitudes[peak] {
+				peak = k
+			}
+		}
+		return peak
+	}
+	previous := -1
+	for i, frame := range frames[:len(frames)-1] {
+		if len(frame) != frameSize/2+1 {
+			t.Fatalf("Expected %d bins, got %d", frameSize/2+1, len(frame))
+		}
+		peak := peakBin(frame)
+		if peak < previous {
+			t.Errorf("Expected the peak bin to move up over time, but it went from %d to %d at frame %d", previous, peak, i)
+		}
+		previous = peak
+	}
+	first, last := peakBin(frames[0]), peakBin(frames[len(frames)-2])
+	if lowFreq := float64(first*sampleRate) / float64(frameSize); lowFreq > 400 {
+		t.Errorf("Expected the first frame to peak near the start of the sweep, got %.0f Hz", lowFreq)
+	}
+	if highFreq := float64(last*sampleRate) / float64(frameSize); highFreq < 2500 {
+		t.Errorf("Expected the last frame to peak near the end of the sweep, got %.0f Hz", highFreq)
+	}
+	if peak := frames[len(frames)/2][peakBin(frames[len(frames)/2])]; peak < 0.5 || peak > 1.1 {
+		t.Errorf("Expected a full scale sine to give a peak of about 1, got %.2f", peak)
+	}
+}
+
+func TestAlignTransients(t *testing.T) {
+	sampleRate := 44100
+	cfg, err := NewSettings(nil, 120, 50, 0.3, sampleRate, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.Drive = 0
+	cfg.NoLimiter = true
+	cfg.FadeDuration = 0
+	cfg.NumOscillators = 3
+	cfg.OscillatorLevels = []float64{1, 1, 1}
+	cfg.OscillatorWaveforms = []int{WaveSine, WaveTriangle, WaveSine}
+	cfg.ClickSource = ClickNoise
+	cfg.AlignTransients = true
+	cfg.WithSeed(3)
+	attackPeak := func(samples []float64) float64 {
+		peak := 0.0
+		for _, sample := range samples[:min(int(0.01*float64(sampleRate)), len(samples))] {
+			peak = math.Max(peak, math.Abs(sample))
+		}
+		return peak
+	}
+	combined, err := cfg.GenerateKick()
+	if err != nil {
+		t.Fatalf("GenerateKick failed: %v", err)
+	}
+	// Each individual layer: the click, and each of the oscillators on their own
+	largest := attackPeak(cfg.kickClick(len(combined)))
+	layerCfg := CopySettings(cfg)
+	layerCfg.ClickSource = ClickNone
+	for n := range cfg.OscillatorLevels {
+		gains := make([]float64, cfg.NumOscillators)
+		gains[n] = 1
+		layer, err := layerCfg.generateKick(gains)
+		if err != nil {
+			t.Fatalf("generateKick failed: %v", err)
+		}
+		largest = math.Max(largest, attackPeak(layer))
+	}
+	if peak := attackPeak(combined); peak < largest {
+		t.Errorf("Expected the combined attack peak to be at least %.3f, got %.3f", largest, peak)
+	}
+}
+
+func TestFileNameTemplate(t *testing.T) {
+	cfg, err := NewSettings(nil, 60, 40, 0.05, 8000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.BPM = 128
+	cfg.FileNameTemplate = "{type}_{bpm}bpm_{n}"
+	if name := cfg.fileName(3); name != "kick_128bpm_3.wav" {
+		t.Errorf("Expected kick_128bpm_3.wav, got %s", name)
+	}
+	dir := t.TempDir()
+	for _, expected := range []string{"kick_128bpm_1.wav", "kick_128bpm_2.wav"} {
+		fileName, err := cfg.GenerateAndSaveTo(dir)
+		if err != nil {
+			t.Fatalf("GenerateAndSaveTo failed: %v", err)
+		}
+		if fileName != filepath.Join(dir, expected) {
+			t.Errorf("Expected %s, got %s", filepath.Join(dir, expected), fileName)
+		}
+	}
+	cfg.FileNameTemplate = "{type}-{rate}.wav"
+	if name := cfg.fileName(2); name != "kick-8000_2.wav" {
+		t.Errorf("Expected kick-8000_2.wav for a template without {n}, got %s", name)
+	}
+}
+
+func TestGenerateFill(t *testing.T) {
+	sampleRate := 22050
+	const bpm = 120.0
+	stepSamples := int(60 / bpm / 4 * float64(sampleRate))
+	for _, style := range []string{"snare", "toms", "mixed"} {
+		fill, err := GenerateFill(style, 2, bpm, sampleRate, 16, 1)
+		if err != nil {
+			t.Fatalf("GenerateFill failed for %s: %v", style, err)
+		}
+		// Count the onsets, as sudden jumps in the level of 5 ms frames
+		frame := sampleRate / 200
+		hits, previous := 0, 0.0
+		for i := 0; i+frame <= len(fill); i += frame {
+			level := rootMeanSquare(fill[i : i+frame])
+			if level > 0.05 && level > 2*previous {
+				hits++
+				i += 4 * frame // skip the rest of the attack
+				level = rootMeanSquare(fill[i : i+frame])
+			}
+			previous = level
+		}
+		if hits != 8 {
+			t.Errorf("Expected 8 hits in the %s fill, got %d", style, hits)
+		}
+		// Every hit should be louder than the one before of the same instrument
+		step := 1
+		if style == "mixed" {
+			step = 2
+		}
+		peakAt := func(hit int) float64 {
+			peak := 0.0
+			for _, sample := range fill[hit*stepSamples : hit*stepSamples+stepSamples/2] {
+				peak = math.Max(peak, math.Abs(sample))
+			}
+			return peak
+		}
+		for hit := step; hit < 8; hit++ {
+			if style == "toms" && hit*3/8 != (hit-step)*3/8 {
+				continue // a different tom
+			}
+			if peakAt(hit) <= peakAt(hit-step) {
+				t.Errorf("Expected hit %d of the %s fill to be louder than hit %d, got %.3f and %.3f", hit, style, hit-step, peakAt(hit), peakAt(hit-step))
+			}
+		}
+	}
+	if _, err := GenerateFill("cowbell", 2, bpm, sampleRate, 16, 1); err == nil {
+		t.Errorf("Expected an error for an unknown fill style")
+	}
+}
+
+func TestResampleWithQuality(t *testing.T) {
+	const freq = 1000.0
+	sine := createSineWave(freq, 8000, 8000)
+	expected := createSineWave(freq, 11025, 11025)
+	resamplingError := func(quality ResampleQuality) float64 {
+		resampled := ResampleWithQuality(sine, 8000, 11025, quality)
+		if len(resampled) != len(expected) {
+			t.Fatalf("Expected %d samples, got %d", len(expected), len(resampled))
+		}
+		sum := 0.0
+		// Skip the edges, where the interpolation runs out of neighbouring samples
+		for i := 100; i < len(expected)-100; i++ {
+			d := resampled[i] - expected[i]
+			sum += d * d
+		}
+		return math.Sqrt(sum / float64(len(expected)-200))
+	}
+	linear, cubic, sinc := resamplingError(ResampleQualityLinear), resamplingError(ResampleQualityCubic), resamplingError(ResampleQualitySinc)
+	if cubic >= linear {
+		t.Errorf("Expected cubic resampling to have a lower error than linear, got %.5f and %.5f", cubic, linear)
+	}
+	if sinc >= cubic {
+		t.Errorf("Expected sinc resampling to have a lower error than cubic, got %.5f and %.5f", sinc, cubic)
+	}
+	if _, err := ParseResampleQuality("cubic"); err != nil {
+		t.Errorf("Expected cubic to be a valid quality, got %v", err)
+	}
+	if _, err := ParseResampleQuality("nearest"); err == nil {
+		t.Errorf("Expected an error for an unknown quality")
+	}
+}
+
+func TestBeatRepeat(t *testing.T) {
+	sampleRate := 1000
+	samples := make([]float64, 1000)
+	for i := range samples {
+		samples[i] = float64(i+1) / 1000
+	}
+	repeated := BeatRepeat(samples, 0.05, 0.1, 4, sampleRate)
+	if len(repeated) != len(samples) {
+		t.Fatalf("Expected %d samples, got %d", len(samples), len(repeated))
+	}
+	slice := samples[:50]
+	count := 0
+	for start := 0; start+len(slice) <= len(repeated); start++ {
+		match := true
+		for i, sample := range slice {
+			if repeated[start+i] != sample {
+				match = false
+				break
+			}
+		}
+		if match {
+			if start%100 != 0 {
+				t.Errorf("Expected the repeats to start every 100 samples, found one at %d", start)
+			}
+			count++
+		}
+	}
+	if count != 4 {
+		t.Errorf("Expected the slice to be repeated 4 times, found it %d times", count)
+	}
+	// After the stutter, the samples continue in time
+	for i := 400; i < len(samples); i++ {
+		if repeated[i] != samples[i] {
+			t.Fatalf("Expected the samples after the stutter to be unchanged, but sample %d differs", i)
+		}
+	}
+}
+
+func TestApplyTempoDelayStereo(t *testing.T) {
+	sampleRate := 1000
+	left := make([]float64, 1000)
+	right := make([]float64, 1000)
+	left[0], right[0] = 1, 1
+	eighth := NoteDivision(1.0 / 8)
+	// At 120 BPM, a dotted eighth is 375 ms and an eighth is 250 ms
+	delayedLeft, delayedRight := ApplyTempoDelayStereo(left, right, 120, eighth.Dotted(), eighth, 0, 0.5, sampleRate)
+	for i := 1; i < len(left); i++ {
+		expectedLeft, expectedRight := 0.0, 0.0
+		if i == 375 {
+			expectedLeft = 0.5
+		}
+		if i == 250 {
+			expectedRight = 0.5
+		}
+		if delayedLeft[i] != expectedLeft || delayedRight[i] != expectedRight {
+			t.Errorf("Expected %v and %v at sample %d, got %v and %v", expectedLeft, expectedRight, i, delayedLeft[i], delayedRight[i])
+		}
+	}
+	if seconds := eighth.Triplet().Seconds(120); math.Abs(seconds-0.5/3) > 1e-12 {
+		t.Errorf("Expected an eighth note triplet to be %v seconds at 120 BPM, got %v", 0.5/3, seconds)
+	}
+}
+
+func TestDriveMode(t *testing.T) {
+	// Ten cycles of a sine, so that the harmonics land exactly on the bins
+	sine := createSineWave(100, 800, 8000)
+	thirdHarmonic := func(samples []float64) float64 {
+		magnitudes := magnitudeSpectrum(samples)
+		return magnitudes[30] / magnitudes[10]
+	}
+	cfg, err := NewSettings(nil, 100, 100, 0.1, 8000, 16, 1)
+	if err != nil {
+		t.Fatalf("NewSettings failed: %v", err)
+	}
+	cfg.Drive = 3
+	modes := []int{DriveSoft, DriveHard, DriveTanh}
+	for _, sliceDrive := range []bool{true, false} {
+		harmonics := make([]float64, len(modes))
+		for i, mode := range modes {
+			cfg.DriveMode = mode
+			driven := make([]float64, len(sine))
+			if sliceDrive {
+				driven = cfg.drive(sine)
+			} else {
+				for j, sample := range sine {
+					driven[j] = cfg.ApplyDrive(sample)
+				}
+			}
+			harmonics[i] = thirdHarmonic(driven)
+			if harmonics[i] < 0.01 {
+				t.Errorf("Expected drive mode %d to add harmonics, got a third harmonic of %.4f", mode, harmonics[i])
+			}
+		}
+		for i := range harmonics {
+			for j := i + 1; j < len(harmonics); j++ {
+				if math.Abs(harmonics[i]-harmonics[j]) < 0.01 {
+					t.Errorf("Expected drive modes %d and %d to sound different, got third harmonics of %.4f and %.4f", modes[i], modes[j], harmonics[i], harmonics[j])
+				}
+			}
+		}
+	}
+	// The default mode keeps the hard clipping of the generators and the soft clipping of the kick
+	cfg.DriveMode = DriveDefault
+	if got, expected := cfg.drive(sine)[20], Drive(sine, 3)[20]; got != expected {
+		t.Errorf("Expected the default drive to hard clip, got %v instead of %v", got, expected)
+	}
+	if got, expected := cfg.ApplyDrive(0.5), 0.5*4/(1+3*0.5); got != expected {
+		t.Errorf("Expected the default kick drive to soft clip, got %v instead of %v", got, expected)
+	}
+	// The other modes drive the kick and the other generators by the same amount
+	for _, mode := range modes {
+		cfg.DriveMode = mode
+		driven := cfg.drive(sine)
+		for i, sample := range sine {
+			if perSample := cfg.ApplyDrive(sample); math.Abs(perSample-driven[i]) > 1e-12 {
+				t.Fatalf("Expected drive mode %d to give the same result per sample and for all samples, got %v and %v at %d", mode, perSample, driven[i], i)
+			}
+		}
+	}
+	cfg.DriveMode = DriveHard
+	cfg.Drive = 0
+	if got := cfg.drive(sine)[20]; got != sine[20] {
+		t.Errorf("Expected a Drive of 0 to leave the samples unchanged, got %v instead of %v", got, sine[20])
+	}
+}
@@ -1,13 +1,29 @@
 package synth
 
 import (
+	"bufio"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
+	"github.com/go-audio/wav"
 	"github.com/xyproto/playsample"
 )
 
+// LoopRegion is a loop region given in sample frames, where End is the last frame that is played in the loop
+type LoopRegion struct {
+	Start int
+	End   int
+}
+
 func (soundType SoundType) String() string {
 	switch soundType {
 	case Kick:
@@ -41,13 +57,52 @@ func (soundType SoundType) String() string {
 	}
 }
 
+// ParseSoundType returns the sound type with the given name, as returned by SoundType.String, like "kick" or "closed_hh"
+func ParseSoundType(name string) (SoundType, error) {
+	for soundType := SoundType(Kick); soundType <= Lead; soundType++ {
+		if soundType.String() == name {
+			return soundType, nil
+		}
+	}
+	return Kick, fmt.Errorf("unknown sound type: %s", name)
+}
+
+// defaultFileNameTemplate is the template for the filenames of GenerateAndSaveTo, if FileNameTemplate is not set
+const defaultFileNameTemplate = "{type}{n}.wav"
+
+// fileName returns the filename for the n-th file of GenerateAndSaveTo, by expanding the placeholders in
+// FileNameTemplate: {type} is the sound type, {bpm} is the BPM, {rate} is the sample rate, {bits} is the
+// bit depth and {n} is the number of the file. If the template has no {n}, the number is appended to the
+// name for the second file and onwards, and if it has no extension, ".wav" is added.
+func (cfg *Settings) fileName(n int) string {
+	template := cfg.FileNameTemplate
+	if template == "" {
+		template = defaultFileNameTemplate
+	}
+	if filepath.Ext(template) == "" {
+		template += ".wav"
+	}
+	if !strings.Contains(template, "{n}") && n > 1 {
+		ext := filepath.Ext(template)
+		template = strings.TrimSuffix(template, ext) + "_{n}" + ext
+	}
+	return strings.NewReplacer(
+		"{type}", cfg.SoundType.String(),
+		"{bpm}", strconv.FormatFloat(cfg.BPM, 'f', -1, 64),
+		"{rate}", strconv.Itoa(cfg.SampleRate),
+		"{bits}", strconv.Itoa(cfg.BitDepth),
+		"{n}", strconv.Itoa(n),
+	).Replace(template)
+}
+
 // GenerateAndSaveTo generates samples for a given type (e.g., "kick", "snare") and saves it to a specified directory, avoiding filename collisions.
+// The filenames follow FileNameTemplate, or "{type}{n}.wav" if it is not set.
 func (cfg *Settings) GenerateAndSaveTo(directory string) (string, error) {
 	n := 1
 	var fileName string
 	for {
-		// Construct the file path with an incrementing number based on the type
-		fileName = filepath.Join(directory, fmt.Sprintf("%s%d.wav", cfg.SoundType, n))
+		// Construct the file path with an incrementing number
+		fileName = filepath.Join(directory, cfg.fileName(n))
 		if _, err := os.Stat(fileName); os.IsNotExist(err) {
 			break
 		}
@@ -72,3 +127,373 @@ func (cfg *Settings) GenerateAndSaveTo(directory string) (string, error) {
 	}
 	return fileName, nil
 }
+
+// ExportSpec is the format of one of the WAV files written by ExportVariants, where Suffix is appended to
+// the name of the sound type in the filename, for example "_44k_16bit"
+type ExportSpec struct {
+	SampleRate int
+	BitDepth   int
+	Channels   int
+	Suffix     string
+}
+
+// ExportVariants generates the configured sound type once, at the highest sample rate of the given variants,
+// and then resamples and requantizes it to each variant and saves it to the given directory, which is
+// useful for creating sample packs. The sound is copied to all channels. Returns the filenames that were written.
+func (cfg *Settings) ExportVariants(variants []ExportSpec, dir string) ([]string, error) {
+	if len(variants) == 0 {
+		return nil, errors.New("no export variants given")
+	}
+	highestSampleRate := 0
+	for _, variant := range variants {
+		if variant.SampleRate <= 0 {
+			return nil, fmt.Errorf("invalid sample rate: %d", variant.SampleRate)
+		}
+		highestSampleRate = max(highestSampleRate, variant.SampleRate)
+	}
+	renderCfg := CopySettings(cfg)
+	renderCfg.SampleRate = highestSampleRate
+	renderCfg.Channels = 1
+	samples, err := renderCfg.Generate()
+	if err != nil {
+		return nil, err
+	}
+	filenames := make([]string, 0, len(variants))
+	for _, variant := range variants {
+		resampled := ResampleSinc(samples, highestSampleRate, variant.SampleRate, 32)
+		interleaved := resampled
+		if variant.Channels > 1 {
+			interleaved = make([]float64, 0, len(resampled)*variant.Channels)
+			for _, sample := range resampled {
+				for c := 0; c < variant.Channels; c++ {
+					interleaved = append(interleaved, sample)
+				}
+			}
+		}
+		filename := filepath.Join(dir, fmt.Sprintf("%s%s.wav", cfg.SoundType, variant.Suffix))
+		file, err := os.Create(filename)
+		if err != nil {
+			return nil, err
+		}
+		err = playsample.SaveToWav(file, interleaved, variant.SampleRate, variant.BitDepth, variant.Channels)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error saving %s: %v", filename, err)
+		}
+		filenames = append(filenames, filename)
+	}
+	return filenames, nil
+}
+
+// GenerateWavBytes generates samples for the configured sound type and returns them encoded as a WAV file,
+// without writing anything to disk. This is useful for serving sounds over HTTP.
+func (cfg *Settings) GenerateWavBytes() ([]byte, error) {
+	samples, err := cfg.Generate()
+	if err != nil {
+		return nil, err
+	}
+	var buf memoryWriteSeeker
+	if err := playsample.SaveToWav(&buf, samples, cfg.SampleRate, cfg.BitDepth, cfg.Channels); err != nil {
+		return nil, fmt.Errorf("error encoding wav: %v", err)
+	}
+	return buf.data, nil
+}
+
+// ServeWav returns an HTTP handler that responds with the samples encoded as a WAV file, for previewing sounds
+// in web tools. The samples are encoded once, when the handler is created. If they could not be encoded,
+// the handler responds with an internal server error.
+func ServeWav(samples []float64, sampleRate, bitDepth, channels int) http.HandlerFunc {
+	var buf memoryWriteSeeker
+	encodeErr := playsample.SaveToWav(&buf, samples, sampleRate, bitDepth, channels)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if encodeErr != nil {
+			http.Error(w, fmt.Sprintf("error encoding wav: %v", encodeErr), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "audio/wav")
+		w.Header().Set("Content-Length", strconv.Itoa(len(buf.data)))
+		if r.Method != http.MethodHead {
+			w.Write(buf.data)
+		}
+	}
+}
+
+// memoryWriteSeeker is an in-memory io.WriteSeeker
+type memoryWriteSeeker struct {
+	data []byte
+	pos  int
+}
+
+// Write writes p at the current position, growing the buffer if needed
+func (m *memoryWriteSeeker) Write(p []byte) (int, error) {
+	if end := m.pos + len(p); end > len(m.data) {
+		m.data = append(m.data, make([]byte, end-len(m.data))...)
+	}
+	n := copy(m.data[m.pos:], p)
+	m.pos += n
+	return n, nil
+}
+
+// Seek sets the position for the next Write
+func (m *memoryWriteSeeker) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = int64(m.pos) + offset
+	case io.SeekEnd:
+		pos = int64(len(m.data)) + offset
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if pos < 0 {
+		return 0, fmt.Errorf("invalid position: %d", pos)
+	}
+	m.pos = int(pos)
+	return pos, nil
+}
+
+// SaveToWavChecked saves the samples to a WAV file, just like playsample.SaveToWav, but also returns
+// the number of samples that were outside of the [-1, 1] range and had to be clamped
+func SaveToWavChecked(w io.WriteSeeker, samples []float64, sampleRate, bitDepth, channels int) (int, error) {
+	clamped := 0
+	for _, sample := range samples {
+		if sample > 1 || sample < -1 {
+			clamped++
+		}
+	}
+	if err := playsample.SaveToWav(w, samples, sampleRate, bitDepth, channels); err != nil {
+		return 0, err
+	}
+	return clamped, nil
+}
+
+// SaveToWavNoiseShaped saves the samples to a WAV file, just like playsample.SaveToWav, but quantizes them with
+// TPDF dither and second order noise shaping, which moves the quantization noise from the low and mid
+// frequencies, where the ear is most sensitive, up to the high frequencies. The dither uses a fixed seed,
+// so the same samples always give the same file.
+func SaveToWavNoiseShaped(w io.WriteSeeker, samples []float64, sampleRate, bitDepth, channels int) error {
+	if bitDepth != 8 && bitDepth != 16 && bitDepth != 24 && bitDepth != 32 {
+		return fmt.Errorf("bitdepth should be 8, 16, 24, or 32, not %d", bitDepth)
+	}
+	if channels <= 0 {
+		return fmt.Errorf("channels should be greater than 0, got %d", channels)
+	}
+	return playsample.SaveToWav(w, noiseShapedQuantize(rand.New(rand.NewSource(1)), samples, bitDepth, channels), sampleRate, bitDepth, channels)
+}
+
+// noiseShapedQuantize quantizes the interleaved samples to the integer steps used by playsample.SaveToWav,
+// using TPDF dither from r and an error feedback filter with the noise transfer function (1 - z^-1)^2.
+// When a sample is clipped at full scale, the error feedback of that channel is reset, since the clipping
+// error is far larger than a quantization step and would otherwise ring through the feedback loop.
+func noiseShapedQuantize(r *rand.Rand, samples []float64, bitDepth, channels int) []float64 {
+	maxIntValue := float64(int(1)<<(bitDepth-1)) - 1
+	quantized := make([]float64, len(samples))
+	errors1 := make([]float64, channels) // the quantization error of the previous sample, per channel
+	errors2 := make([]float64, channels) // the quantization error of the sample before that, per channel
+	for i, sample := range samples {
+		c := i % channels
+		target := sample*maxIntValue - 2*errors1[c] + errors2[c]
+		dither := r.Float64() - r.Float64()
+		q := math.Round(target + dither)
+		if clipped := math.Max(math.Min(q, maxIntValue), -maxIntValue-1); clipped != q {
+			q = clipped
+			errors2[c], errors1[c] = 0, 0
+		} else {
+			errors2[c], errors1[c] = errors1[c], q-target
+		}
+		quantized[i] = q / maxIntValue
+	}
+	return quantized
+}
+
+// ExportCSV writes the samples as CSV, with a "time,amplitude" header and then one row per sample,
+// where the time is in seconds. This is useful for analyzing a waveform in a spreadsheet or in Python.
+func ExportCSV(w io.Writer, samples []float64, sampleRate int) error {
+	if sampleRate <= 0 {
+		return fmt.Errorf("invalid sample rate: %d", sampleRate)
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString("time,amplitude\n")
+	for i, sample := range samples {
+		bw.WriteString(strconv.FormatFloat(float64(i)/float64(sampleRate), 'g', -1, 64))
+		bw.WriteByte(',')
+		bw.WriteString(strconv.FormatFloat(sample, 'g', -1, 64))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// LoadRawPCM reads headerless PCM data with interleaved integer samples until the end of the reader.
+// 8-bit samples are unsigned, like in WAV files, while 16, 24 and 32-bit samples are signed.
+// The samples are scaled to the [-1, 1] range in the same way as playsample.LoadWav does it.
+func LoadRawPCM(r io.Reader, bitDepth, channels int, littleEndian bool) ([]float64, error) {
+	if bitDepth != 8 && bitDepth != 16 && bitDepth != 24 && bitDepth != 32 {
+		return nil, fmt.Errorf("bitdepth should be 8, 16, 24, or 32, not %d", bitDepth)
+	}
+	if channels <= 0 {
+		return nil, fmt.Errorf("channels should be greater than 0, got %d", channels)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	bytesPerSample := bitDepth / 8
+	if len(data)%(bytesPerSample*channels) != 0 {
+		return nil, fmt.Errorf("the raw PCM data (%d bytes) does not contain whole %d-bit frames with %d channels", len(data), bitDepth, channels)
+	}
+	maxIntValue := float64(int(1) << (bitDepth - 1))
+	samples := make([]float64, len(data)/bytesPerSample)
+	for i := range samples {
+		b := data[i*bytesPerSample : (i+1)*bytesPerSample]
+		if bitDepth == 8 {
+			samples[i] = (float64(b[0]) - 128) / maxIntValue
+			continue
+		}
+		var v uint32
+		for j := range b {
+			shift := 8 * j
+			if !littleEndian {
+				shift = 8 * (len(b) - 1 - j)
+			}
+			v |= uint32(b[j]) << shift
+		}
+		// Sign extend from the bit depth to 32 bits
+		signed := int32(v<<(32-bitDepth)) >> (32 - bitDepth)
+		samples[i] = float64(signed) / maxIntValue
+	}
+	return samples, nil
+}
+
+// SaveRawPCM writes the samples as headerless little-endian PCM data, with the same integer conversion as
+// playsample.SaveToWav. 8-bit samples are unsigned, while 16, 24 and 32-bit samples are signed.
+func SaveRawPCM(w io.Writer, samples []float64, bitDepth int) error {
+	if bitDepth != 8 && bitDepth != 16 && bitDepth != 24 && bitDepth != 32 {
+		return fmt.Errorf("bitdepth should be 8, 16, 24, or 32, not %d", bitDepth)
+	}
+	bytesPerSample := bitDepth / 8
+	maxIntValue := float64(int(1)<<(bitDepth-1)) - 1
+	data := make([]byte, 0, len(samples)*bytesPerSample)
+	for _, sample := range samples {
+		v := int32(math.Round(math.Max(-1, math.Min(1, sample)) * maxIntValue))
+		if bitDepth == 8 {
+			data = append(data, byte(v+128))
+			continue
+		}
+		for j := 0; j < bytesPerSample; j++ {
+			data = append(data, byte(uint32(v)>>(8*j)))
+		}
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// SaveToWavWithLoop saves the samples to a WAV file, just like playsample.SaveToWav,
+// but also writes a smpl chunk containing the given loop region, for use with samplers.
+func SaveToWavWithLoop(w io.WriteSeeker, samples []float64, sampleRate, bitDepth, channels int, loop LoopRegion) error {
+	if channels <= 0 {
+		return fmt.Errorf("channels should be greater than 0, got %d", channels)
+	}
+	if loop.Start < 0 || loop.End < loop.Start || loop.End >= len(samples)/channels {
+		return fmt.Errorf("invalid loop region: %d to %d", loop.Start, loop.End)
+	}
+	if err := playsample.SaveToWav(w, samples, sampleRate, bitDepth, channels); err != nil {
+		return err
+	}
+	// Append the smpl chunk after all the other chunks
+	end, err := w.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	chunk := []uint32{
+		0,                                 // manufacturer
+		0,                                 // product
+		uint32(1e9 / float64(sampleRate)), // sample period in nanoseconds
+		60,                                // MIDI unity note
+		0,                                 // MIDI pitch fraction
+		0,                                 // SMPTE format
+		0,                                 // SMPTE offset
+		1,                                 // number of sample loops
+		0,                                 // sampler data
+		0,                                 // cue point ID
+		0,                                 // loop type (forward)
+		uint32(loop.Start),                // loop start
+		uint32(loop.End),                  // loop end
+		0,                                 // fraction
+		0,                                 // play count (infinite)
+	}
+	if _, err := w.Write([]byte("smpl")); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(chunk)*4)); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, chunk); err != nil {
+		return err
+	}
+	// Update the RIFF chunk size in the header
+	total := end + 8 + int64(len(chunk)*4)
+	if _, err := w.Seek(4, io.SeekStart); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, uint32(total-8))
+}
+
+// LoadWavWithLoop loads a WAV file and returns the samples, the sample rate and the first loop region
+// found in the smpl chunk. The returned loop region is nil if the file has no loop points.
+func LoadWavWithLoop(filename string) ([]float64, int, *LoopRegion, error) {
+	samples, sampleRate, err := playsample.LoadWav(filename, false)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	defer f.Close()
+	decoder := wav.NewDecoder(f)
+	decoder.ReadMetadata()
+	if err := decoder.Err(); err != nil {
+		return nil, 0, nil, fmt.Errorf("error reading WAV metadata: %v", err)
+	}
+	if decoder.Metadata == nil || decoder.Metadata.SamplerInfo == nil || len(decoder.Metadata.SamplerInfo.Loops) == 0 {
+		return samples, sampleRate, nil, nil
+	}
+	loop := decoder.Metadata.SamplerInfo.Loops[0]
+	return samples, sampleRate, &LoopRegion{Start: int(loop.Start), End: int(loop.End)}, nil
+}
+
+// loadWavMono loads a WAV file and returns the samples as a single channel, together with the sample rate.
+// Files with more than one channel are downmixed by averaging the channels of each frame.
+func loadWavMono(filename string) ([]float64, int, error) {
+	samples, sampleRate, err := playsample.LoadWav(filename, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	decoder := wav.NewDecoder(f)
+	decoder.ReadInfo()
+	if err := decoder.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error reading WAV info: %v", err)
+	}
+	channels := int(decoder.NumChans)
+	if channels <= 1 {
+		return samples, sampleRate, nil
+	}
+	mono := make([]float64, len(samples)/channels)
+	for i := range mono {
+		sum := 0.0
+		for _, sample := range samples[i*channels : (i+1)*channels] {
+			sum += sample
+		}
+		mono[i] = sum / float64(channels)
+	}
+	return mono, sampleRate, nil
+}
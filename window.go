@@ -0,0 +1,53 @@
+package synth
+
+import (
+	"math"
+)
+
+// WindowKind is the kind of window function that is returned by Window
+type WindowKind int
+
+// Constants for window kinds
+const (
+	WindowRectangular WindowKind = iota
+	WindowHann
+	WindowHamming
+	WindowBlackman
+)
+
+// Window returns a symmetric window function of the given length and kind, for use with spectral analysis and
+// other block based processing. Unknown kinds give a rectangular window.
+func Window(length int, kind WindowKind) []float64 {
+	if length <= 0 {
+		return []float64{}
+	}
+	window := make([]float64, length)
+	if length == 1 {
+		window[0] = 1
+		return window
+	}
+	for n := range window {
+		x := 2 * math.Pi * float64(n) / float64(length-1)
+		switch kind {
+		case WindowHann:
+			window[n] = 0.5 - 0.5*math.Cos(x)
+		case WindowHamming:
+			window[n] = 0.54 - 0.46*math.Cos(x)
+		case WindowBlackman:
+			window[n] = 0.42 - 0.5*math.Cos(x) + 0.08*math.Cos(2*x)
+		default:
+			window[n] = 1
+		}
+	}
+	return window
+}
+
+// ApplyWindow multiplies the samples with the given window and returns the result.
+// If the window is shorter than the samples, the remaining samples are set to 0.
+func ApplyWindow(samples, window []float64) []float64 {
+	windowed := make([]float64, len(samples))
+	for i := 0; i < len(samples) && i < len(window); i++ {
+		windowed[i] = samples[i] * window[i]
+	}
+	return windowed
+}